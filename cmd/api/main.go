@@ -36,6 +36,15 @@ func main() {
 	// analyticsService is responsible for providing the analytics data as provided in the problem statement
 	analyticsService := services.NewAnalyticsService(db)
 
+	// Derived customer data is recomputed after every successful refresh
+	dataLoader.OnRefreshCompleted("rfm_scores", func(ctx context.Context, logID int) error {
+		return analyticsService.RefreshRFMScores(ctx, logID, cfg.RFMBuckets)
+	})
+	dataLoader.OnRefreshCompleted("churn_scores", analyticsService.RefreshChurnScores)
+	dataLoader.OnRefreshCompleted("revenue_anomalies", func(ctx context.Context, logID int) error {
+		return analyticsService.DetectRevenueAnomalies(ctx, logID, cfg.AnomalyWeeks, cfg.AnomalyThreshold)
+	})
+
 	// Initialize context for background refresh scheduler
 	ctx, cancel := context.WithCancel(context.Background())
 	// cancel the context when the main function is finished
@@ -15,10 +15,51 @@ func setupRoutes(analyticsHandler *handlers.AnalyticsHandler) *mux.Router {
 	router.HandleFunc("/api/revenue/by-product", analyticsHandler.GetRevenueByProduct).Methods("GET")
 	router.HandleFunc("/api/revenue/by-category", analyticsHandler.GetRevenueByCategory).Methods("GET")
 	router.HandleFunc("/api/revenue/by-region", analyticsHandler.GetRevenueByRegion).Methods("GET")
+	router.HandleFunc("/api/revenue/by-payment-method", analyticsHandler.GetRevenueByPaymentMethod).Methods("GET")
+	router.HandleFunc("/api/revenue/by-customer", analyticsHandler.GetRevenueByCustomer).Methods("GET")
 	router.HandleFunc("/api/revenue/over-time", analyticsHandler.GetRevenueOverTime).Methods("GET")
+	router.HandleFunc("/api/revenue/hierarchy", analyticsHandler.GetRevenueHierarchy).Methods("GET")
+	router.HandleFunc("/api/revenue/margin", analyticsHandler.GetGrossMargin).Methods("GET")
+	router.HandleFunc("/api/revenue/forecast", analyticsHandler.GetRevenueForecast).Methods("GET")
+	router.HandleFunc("/api/revenue/anomalies", analyticsHandler.GetRevenueAnomalies).Methods("GET")
 
-	// Data refresh endpoint
+	// Customer analytics endpoints
+	router.HandleFunc("/api/customers/top", analyticsHandler.GetTopCustomers).Methods("GET")
+	router.HandleFunc("/api/customers/lifetime-value", analyticsHandler.GetCustomerLifetimeValue).Methods("GET")
+	router.HandleFunc("/api/customers/rfm", analyticsHandler.GetRFMScores).Methods("GET")
+	router.HandleFunc("/api/customers/churn", analyticsHandler.GetChurnScores).Methods("GET")
+	router.HandleFunc("/api/customers/cohorts", analyticsHandler.GetCohortRetention).Methods("GET")
+	router.HandleFunc("/api/customers/new-vs-returning", analyticsHandler.GetNewVsReturning).Methods("GET")
+
+	// Product analytics endpoints
+	router.HandleFunc("/api/products/affinity", analyticsHandler.GetProductAffinity).Methods("GET")
+	router.HandleFunc("/api/products/abc", analyticsHandler.GetProductABC).Methods("GET")
+
+	// Discount endpoints
+	router.HandleFunc("/api/discounts/bands", analyticsHandler.GetRevenueByDiscountBand).Methods("GET")
+	router.HandleFunc("/api/discounts/leakage", analyticsHandler.GetDiscountLeakage).Methods("GET")
+	router.HandleFunc("/api/discounts/quantity", analyticsHandler.GetDiscountQuantityRelationship).Methods("GET")
+
+	// Payment endpoints
+	router.HandleFunc("/api/payments/mix", analyticsHandler.GetPaymentMix).Methods("GET")
+
+	// Shipping endpoints
+	router.HandleFunc("/api/shipping/costs", analyticsHandler.GetShippingCosts).Methods("GET")
+
+	// Generic dimension/measure query, new breakdowns don't need a new endpoint
+	router.HandleFunc("/api/analytics/query", analyticsHandler.RunQuery).Methods("POST")
+	router.HandleFunc("/api/analytics/pivot", analyticsHandler.RunPivot).Methods("POST")
+
+	// Order endpoints
+	router.HandleFunc("/api/orders/distribution", analyticsHandler.GetOrderDistribution).Methods("GET")
+
+	// Lineage endpoints
+	router.HandleFunc("/api/orders/{order_id}/lineage", analyticsHandler.GetOrderLineage).Methods("GET")
+
+	// Data refresh endpoints
 	router.HandleFunc("/api/data/refresh", analyticsHandler.TriggerDataRefresh).Methods("POST")
+	router.HandleFunc("/api/data/costs", analyticsHandler.LoadProductCosts).Methods("POST")
+	router.HandleFunc("/api/data/hierarchies", analyticsHandler.LoadHierarchyMapping).Methods("POST")
 
 	return router
 }
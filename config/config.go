@@ -20,6 +20,10 @@ type Config struct {
 	LogPath          string
 	RefreshBatchSize int
 	DefaultCSVPath   string
+	RefreshLoadMode  string
+	RFMBuckets       int
+	AnomalyWeeks     int
+	AnomalyThreshold float64
 }
 
 // LoadConfig loads the configuration for the application using godotenv package
@@ -34,6 +38,9 @@ func LoadConfig() (*Config, error) {
 	godotenv.Load()
 
 	batchSize, _ := strconv.Atoi(getEnv("REFRESH_BATCH_SIZE", "1000"))
+	rfmBuckets, _ := strconv.Atoi(getEnv("RFM_BUCKETS", "5"))
+	anomalyWeeks, _ := strconv.Atoi(getEnv("ANOMALY_WEEKS", "8"))
+	anomalyThreshold, _ := strconv.ParseFloat(getEnv("ANOMALY_THRESHOLD", "3"), 64)
 
 	return &Config{
 		DBHost:           getEnv("DB_HOST", "localhost"),
@@ -47,6 +54,10 @@ func LoadConfig() (*Config, error) {
 		LogPath:          getEnv("LOG_PATH", "logs/application.log"),
 		RefreshBatchSize: batchSize,
 		DefaultCSVPath:   getEnv("DEFAULT_CSV_PATH", "./sample.csv"),
+		RefreshLoadMode:  getEnv("REFRESH_LOAD_MODE", "upsert"), // append, upsert, full_replace or partition_replace
+		RFMBuckets:       rfmBuckets,                            // quantile buckets for recency, frequency and monetary scores
+		AnomalyWeeks:     anomalyWeeks,                          // previous same weekdays daily revenue is compared with
+		AnomalyThreshold: anomalyThreshold,                      // z-score at which a day is flagged
 	}, nil
 }
 
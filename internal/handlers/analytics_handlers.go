@@ -3,13 +3,30 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/prajwalbharadwajbm/backend_assessment/internal/services"
 )
 
+const (
+	// Largest rolling window accepted on revenue over time, in periods
+	maxRollingWindow = 366
+
+	// Forecast defaults and the furthest ahead a forecast can go
+	defaultForecastPeriods    = 6
+	defaultForecastConfidence = 0.95
+	maxForecastPeriods        = 120
+
+	// Histogram bins on the order distribution endpoint
+	defaultDistributionBins = 10
+	maxDistributionBins     = 200
+)
+
 type AnalyticsHandler struct {
 	analyticsService *services.AnalyticsService
 	dataLoader       *services.DataLoader
@@ -37,6 +54,30 @@ func validateDateRange(startDate, endDate string) (string, string, error) {
 	return startDate, endDate, nil
 }
 
+// validateAsOf checks the as_of parameter, which selects current or at-time-of-sale attributes
+func validateAsOf(asOf string) (string, error) {
+	switch asOf {
+	case "":
+		return services.AttributesCurrent, nil
+	case services.AttributesCurrent, services.AttributesAtSale:
+		return asOf, nil
+	default:
+		return "", errors.New("invalid as_of: must be 'current' or 'sale'")
+	}
+}
+
+// validateRevenueBasis checks the revenue_basis parameter, which picks how shipping counts towards revenue
+func validateRevenueBasis(basis string) (string, error) {
+	switch basis {
+	case "":
+		return services.RevenueProduct, nil
+	case services.RevenueProduct, services.RevenueWithShipping, services.RevenueNetOfShipping:
+		return basis, nil
+	default:
+		return "", errors.New("invalid revenue_basis: must be 'product', 'with_shipping' or 'net_of_shipping'")
+	}
+}
+
 // RespondWithJSON helper function to respond with JSON
 func RespondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	response, err := json.Marshal(payload)
@@ -58,135 +99,502 @@ func RespondWithError(w http.ResponseWriter, code int, message string) {
 
 // GetTotalRevenue handles requests for total revenue
 func (h *AnalyticsHandler) GetTotalRevenue(w http.ResponseWriter, r *http.Request) {
-	startDate := r.URL.Query().Get("start_date")
-	endDate := r.URL.Query().Get("end_date")
+	filter, err := parseFilter(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	var err error
-	startDate, endDate, err = validateDateRange(startDate, endDate)
+	comparison, err := parseComparison(r, filter)
 	if err != nil {
 		RespondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	revenue, err := h.analyticsService.GetRevenueByDateRange(r.Context(), startDate, endDate)
+	revenue, err := h.analyticsService.GetRevenueByDateRange(r.Context(), filter)
 	if err != nil {
 		RespondWithError(w, http.StatusInternalServerError, "Failed to calculate revenue: "+err.Error())
 		return
 	}
 
-	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"start_date": startDate,
-		"end_date":   endDate,
+	response := map[string]interface{}{
+		"start_date": filter.StartDate,
+		"end_date":   filter.EndDate,
 		"revenue":    revenue,
-	})
+	}
+
+	if comparison != nil {
+		comparisonRevenue, err := h.analyticsService.GetRevenueByDateRange(r.Context(), *comparison)
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to calculate comparison revenue: "+err.Error())
+			return
+		}
+
+		values := services.CompareValues(revenue, comparisonRevenue)
+		response["comparison"] = comparisonPeriod(r, comparison)
+		response["comparison_revenue"] = values["comparison"]
+		response["change"] = values["change"]
+		response["change_pct"] = values["change_pct"]
+	}
+
+	RespondWithJSON(w, http.StatusOK, response)
 }
 
 // GetRevenueByProduct handles requests for revenue by product
 func (h *AnalyticsHandler) GetRevenueByProduct(w http.ResponseWriter, r *http.Request) {
-	startDate := r.URL.Query().Get("start_date")
-	endDate := r.URL.Query().Get("end_date")
+	filter, err := parseFilter(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	var err error
-	startDate, endDate, err = validateDateRange(startDate, endDate)
+	comparison, err := parseComparison(r, filter)
 	if err != nil {
 		RespondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	revenues, err := h.analyticsService.GetRevenueByProduct(r.Context(), startDate, endDate)
+	revenues, err := h.analyticsService.GetRevenueByProduct(r.Context(), filter)
 	if err != nil {
 		RespondWithError(w, http.StatusInternalServerError, "Failed to calculate revenue by product: "+err.Error())
 		return
 	}
 
-	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"start_date": startDate,
-		"end_date":   endDate,
+	response := map[string]interface{}{
+		"start_date": filter.StartDate,
+		"end_date":   filter.EndDate,
+		"as_of":      filter.AsOf,
 		"data":       revenues,
-	})
+	}
+
+	if comparison != nil {
+		previous, err := h.analyticsService.GetRevenueByProduct(r.Context(), *comparison)
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to calculate comparison revenue by product: "+err.Error())
+			return
+		}
+
+		// With a limit only the current top rows are compared, otherwise rows that dropped to zero are kept too
+		response["data"] = services.CompareRows(revenues, previous, "product_id", filter.Limit == 0)
+		response["comparison"] = comparisonPeriod(r, comparison)
+	}
+
+	RespondWithJSON(w, http.StatusOK, response)
 }
 
 // GetRevenueByCategory handles requests for revenue by category
 func (h *AnalyticsHandler) GetRevenueByCategory(w http.ResponseWriter, r *http.Request) {
-	startDate := r.URL.Query().Get("start_date")
-	endDate := r.URL.Query().Get("end_date")
+	filter, err := parseFilter(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	var err error
-	startDate, endDate, err = validateDateRange(startDate, endDate)
+	comparison, err := parseComparison(r, filter)
 	if err != nil {
 		RespondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	revenues, err := h.analyticsService.GetRevenueByCategory(r.Context(), startDate, endDate)
+	revenues, err := h.analyticsService.GetRevenueByCategory(r.Context(), filter)
 	if err != nil {
 		RespondWithError(w, http.StatusInternalServerError, "Failed to calculate revenue by category: "+err.Error())
 		return
 	}
 
-	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"start_date": startDate,
-		"end_date":   endDate,
+	response := map[string]interface{}{
+		"start_date": filter.StartDate,
+		"end_date":   filter.EndDate,
+		"as_of":      filter.AsOf,
 		"data":       revenues,
-	})
+	}
+
+	if comparison != nil {
+		previous, err := h.analyticsService.GetRevenueByCategory(r.Context(), *comparison)
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to calculate comparison revenue by category: "+err.Error())
+			return
+		}
+
+		// With a limit only the current top rows are compared, otherwise rows that dropped to zero are kept too
+		response["data"] = services.CompareRows(revenues, previous, "category", filter.Limit == 0)
+		response["comparison"] = comparisonPeriod(r, comparison)
+	}
+
+	RespondWithJSON(w, http.StatusOK, response)
 }
 
 // GetRevenueByRegion handles requests for revenue by region
 func (h *AnalyticsHandler) GetRevenueByRegion(w http.ResponseWriter, r *http.Request) {
-	startDate := r.URL.Query().Get("start_date")
-	endDate := r.URL.Query().Get("end_date")
+	filter, err := parseFilter(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	var err error
-	startDate, endDate, err = validateDateRange(startDate, endDate)
+	comparison, err := parseComparison(r, filter)
 	if err != nil {
 		RespondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	revenues, err := h.analyticsService.GetRevenueByRegion(r.Context(), startDate, endDate)
+	revenues, err := h.analyticsService.GetRevenueByRegion(r.Context(), filter)
 	if err != nil {
 		RespondWithError(w, http.StatusInternalServerError, "Failed to calculate revenue by region: "+err.Error())
 		return
 	}
 
+	response := map[string]interface{}{
+		"start_date": filter.StartDate,
+		"end_date":   filter.EndDate,
+		"data":       revenues,
+	}
+
+	if comparison != nil {
+		previous, err := h.analyticsService.GetRevenueByRegion(r.Context(), *comparison)
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to calculate comparison revenue by region: "+err.Error())
+			return
+		}
+
+		// With a limit only the current top rows are compared, otherwise rows that dropped to zero are kept too
+		response["data"] = services.CompareRows(revenues, previous, "region", filter.Limit == 0)
+		response["comparison"] = comparisonPeriod(r, comparison)
+	}
+
+	RespondWithJSON(w, http.StatusOK, response)
+}
+
+// GetRevenueByPaymentMethod handles requests for revenue, orders and average order value by payment method
+func (h *AnalyticsHandler) GetRevenueByPaymentMethod(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseFilter(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	comparison, err := parseComparison(r, filter)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	revenues, err := h.analyticsService.GetRevenueByPaymentMethod(r.Context(), filter)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to calculate revenue by payment method: "+err.Error())
+		return
+	}
+
+	response := map[string]interface{}{
+		"start_date": filter.StartDate,
+		"end_date":   filter.EndDate,
+		"data":       revenues,
+	}
+
+	if comparison != nil {
+		previous, err := h.analyticsService.GetRevenueByPaymentMethod(r.Context(), *comparison)
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, "Failed to calculate comparison revenue by payment method: "+err.Error())
+			return
+		}
+
+		response["data"] = services.CompareRows(revenues, previous, "payment_method", filter.Limit == 0)
+		response["comparison"] = comparisonPeriod(r, comparison)
+	}
+
+	RespondWithJSON(w, http.StatusOK, response)
+}
+
+// GetGrossMargin handles requests for cost of goods sold and gross margin by product, category or region
+func (h *AnalyticsHandler) GetGrossMargin(w http.ResponseWriter, r *http.Request) {
+	groupBy := r.URL.Query().Get("group_by")
+	if groupBy == "" {
+		groupBy = "category"
+	}
+
+	if groupBy != "product" && groupBy != "category" && groupBy != "region" {
+		RespondWithError(w, http.StatusBadRequest, "invalid group_by: must be 'product', 'category' or 'region'")
+		return
+	}
+
+	filter, err := parseFilter(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	margins, err := h.analyticsService.GetGrossMargin(r.Context(), filter, groupBy)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to get gross margin: "+err.Error())
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"start_date": filter.StartDate,
+		"end_date":   filter.EndDate,
+		"group_by":   groupBy,
+		"data":       margins,
+	})
+}
+
+// GetRevenueHierarchy handles requests for revenue rolled up along the location or category hierarchy
+// path drills into a branch (path=Europe,Germany), depth limits how many levels below it are expanded
+func (h *AnalyticsHandler) GetRevenueHierarchy(w http.ResponseWriter, r *http.Request) {
+	hierarchy := r.URL.Query().Get("hierarchy")
+	if hierarchy == "" {
+		hierarchy = services.HierarchyLocation
+	}
+
+	levels, err := services.HierarchyLevels(hierarchy)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	path := queryValues(r, "path")
+	if len(path) >= len(levels) {
+		RespondWithError(w, http.StatusBadRequest, "invalid path: can fix at most "+strconv.Itoa(len(levels)-1)+" levels of the "+hierarchy+" hierarchy")
+		return
+	}
+
+	depth := 0
+	if raw := r.URL.Query().Get("depth"); raw != "" {
+		depth, err = strconv.Atoi(raw)
+		if err != nil || depth < 0 {
+			RespondWithError(w, http.StatusBadRequest, "invalid depth: must be a positive number of levels")
+			return
+		}
+	}
+
+	filter, err := parseFilter(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tree, err := h.analyticsService.GetRevenueHierarchy(r.Context(), filter, hierarchy, path, depth)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to calculate revenue by hierarchy: "+err.Error())
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"start_date": filter.StartDate,
+		"end_date":   filter.EndDate,
+		"hierarchy":  hierarchy,
+		"levels":     levels,
+		"path":       path,
+		"data":       tree,
+	})
+}
+
+// GetRevenueAnomalies handles requests for the days where revenue for a region or category looked unusual
+func (h *AnalyticsHandler) GetRevenueAnomalies(w http.ResponseWriter, r *http.Request) {
+	startDate, endDate, err := validateDateRange(r.URL.Query().Get("start_date"), r.URL.Query().Get("end_date"))
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	dimension := r.URL.Query().Get("dimension")
+	if dimension != "" && dimension != "region" && dimension != "category" {
+		RespondWithError(w, http.StatusBadRequest, "invalid dimension: must be 'region' or 'category'")
+		return
+	}
+
+	direction := r.URL.Query().Get("direction")
+	if direction != "" && direction != "drop" && direction != "spike" {
+		RespondWithError(w, http.StatusBadRequest, "invalid direction: must be 'drop' or 'spike'")
+		return
+	}
+
+	limit := 0
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 0 {
+			RespondWithError(w, http.StatusBadRequest, "invalid limit: must be a positive number")
+			return
+		}
+	}
+
+	anomalies, err := h.analyticsService.GetRevenueAnomalies(r.Context(), startDate, endDate, dimension, direction, limit)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to get revenue anomalies: "+err.Error())
+		return
+	}
+
 	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
 		"start_date": startDate,
 		"end_date":   endDate,
+		"data":       anomalies,
+	})
+}
+
+// GetRevenueForecast handles requests for revenue forecasts with prediction intervals
+func (h *AnalyticsHandler) GetRevenueForecast(w http.ResponseWriter, r *http.Request) {
+	opts := services.ForecastOptions{
+		Interval:   r.URL.Query().Get("interval"),
+		Method:     r.URL.Query().Get("method"),
+		Periods:    defaultForecastPeriods,
+		Confidence: defaultForecastConfidence,
+		GroupBy:    r.URL.Query().Get("group_by"),
+	}
+
+	if opts.Interval == "" {
+		opts.Interval = "monthly"
+	}
+
+	if opts.Method == "" {
+		opts.Method = services.ForecastHoltWinters
+	}
+
+	if opts.Method != services.ForecastHoltWinters && opts.Method != services.ForecastLinear {
+		RespondWithError(w, http.StatusBadRequest, "invalid method: must be 'holt_winters' or 'linear'")
+		return
+	}
+
+	if opts.GroupBy != "" && opts.GroupBy != "category" && opts.GroupBy != "region" {
+		RespondWithError(w, http.StatusBadRequest, "invalid group_by: must be 'category' or 'region'")
+		return
+	}
+
+	var err error
+	if raw := r.URL.Query().Get("periods"); raw != "" {
+		opts.Periods, err = strconv.Atoi(raw)
+		if err != nil || opts.Periods < 1 || opts.Periods > maxForecastPeriods {
+			RespondWithError(w, http.StatusBadRequest, "invalid periods: must be between 1 and "+strconv.Itoa(maxForecastPeriods))
+			return
+		}
+	}
+
+	if raw := r.URL.Query().Get("season_length"); raw != "" {
+		opts.SeasonLength, err = strconv.Atoi(raw)
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, "invalid season_length: must be a number of periods")
+			return
+		}
+	}
+
+	if raw := r.URL.Query().Get("confidence"); raw != "" {
+		opts.Confidence, err = strconv.ParseFloat(raw, 64)
+		if err != nil || opts.Confidence <= 0 || opts.Confidence >= 1 {
+			RespondWithError(w, http.StatusBadRequest, "invalid confidence: must be between 0 and 1")
+			return
+		}
+	}
+
+	filter, err := parseFilter(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	forecasts, err := h.analyticsService.GetRevenueForecast(r.Context(), filter, opts)
+	if errors.Is(err, services.ErrInsufficientHistory) {
+		RespondWithError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to forecast revenue: "+err.Error())
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"start_date": filter.StartDate,
+		"end_date":   filter.EndDate,
+		"interval":   opts.Interval,
+		"periods":    opts.Periods,
+		"group_by":   opts.GroupBy,
+		"data":       forecasts,
+	})
+}
+
+// GetRevenueByCustomer handles requests for revenue by customer
+// group_by=master groups customers linked by identity resolution under their master customer
+func (h *AnalyticsHandler) GetRevenueByCustomer(w http.ResponseWriter, r *http.Request) {
+	groupBy, ok := validateGroupBy(r)
+	if !ok {
+		RespondWithError(w, http.StatusBadRequest, "invalid group_by: must be 'customer' or 'master'")
+		return
+	}
+
+	filter, err := parseCustomerFilter(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	revenues, err := h.analyticsService.GetRevenueByCustomer(r.Context(), filter, groupBy)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to calculate revenue by customer: "+err.Error())
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"start_date": filter.StartDate,
+		"end_date":   filter.EndDate,
+		"group_by":   groupBy,
 		"data":       revenues,
 	})
 }
 
 // GetRevenueOverTime handles requests for revenue trends over time
 func (h *AnalyticsHandler) GetRevenueOverTime(w http.ResponseWriter, r *http.Request) {
-	startDate := r.URL.Query().Get("start_date")
-	endDate := r.URL.Query().Get("end_date")
 	interval := r.URL.Query().Get("interval")
 
 	if interval == "" {
 		interval = "monthly"
 	}
 
-	var err error
-	startDate, endDate, err = validateDateRange(startDate, endDate)
+	filter, err := parseFilter(r)
 	if err != nil {
 		RespondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	revenues, err := h.analyticsService.GetRevenueOverTime(r.Context(), startDate, endDate, interval)
+	// rolling=7,30 adds the average revenue over the last 7 and 30 periods
+	var rollingWindows []int
+	for _, raw := range queryValues(r, "rolling") {
+		window, err := strconv.Atoi(raw)
+		if err != nil || window < 1 || window > maxRollingWindow {
+			RespondWithError(w, http.StatusBadRequest, "invalid rolling window: must be between 1 and "+strconv.Itoa(maxRollingWindow)+" periods")
+			return
+		}
+		rollingWindows = append(rollingWindows, window)
+	}
+
+	revenues, err := h.analyticsService.GetRevenueOverTime(r.Context(), filter, interval, rollingWindows)
 	if err != nil {
 		RespondWithError(w, http.StatusInternalServerError, "Failed to calculate revenue over time: "+err.Error())
 		return
 	}
 
 	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"start_date": startDate,
-		"end_date":   endDate,
+		"start_date": filter.StartDate,
+		"end_date":   filter.EndDate,
 		"interval":   interval,
+		"rolling":    rollingWindows,
 		"data":       revenues,
 	})
 }
 
+// GetOrderLineage handles requests for the source file, line and refresh an order was loaded from
+func (h *AnalyticsHandler) GetOrderLineage(w http.ResponseWriter, r *http.Request) {
+	orderID := mux.Vars(r)["order_id"]
+
+	lineage, err := h.analyticsService.GetOrderLineage(r.Context(), orderID)
+	if errors.Is(err, services.ErrOrderNotFound) {
+		RespondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to get order lineage: "+err.Error())
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, lineage)
+}
+
 // TriggerDataRefresh handles requests to manually trigger a data refresh
 func (h *AnalyticsHandler) TriggerDataRefresh(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -196,6 +604,7 @@ func (h *AnalyticsHandler) TriggerDataRefresh(w http.ResponseWriter, r *http.Req
 
 	var requestBody struct {
 		FilePath string `json:"file_path"`
+		LoadMode string `json:"load_mode"`
 	}
 
 	decoder := json.NewDecoder(r.Body)
@@ -209,15 +618,88 @@ func (h *AnalyticsHandler) TriggerDataRefresh(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	loadMode, err := services.ValidateLoadMode(requestBody.LoadMode)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	// Start the refresh in a goroutine so it doesn't block the response
 	go func() {
-		if err := h.dataLoader.RefreshData(context.Background(), requestBody.FilePath, "API"); err != nil {
+		if err := h.dataLoader.RefreshData(context.Background(), requestBody.FilePath, "API", loadMode); err != nil {
 			// Log the error but don't return it since we're in a goroutine
 			log.Printf("Data refresh failed: %v", err)
 		}
 	}()
 
 	RespondWithJSON(w, http.StatusAccepted, map[string]string{
-		"message": "Data refresh triggered successfully",
+		"message":   "Data refresh triggered successfully",
+		"load_mode": loadMode,
+	})
+}
+
+// LoadProductCosts handles loading product unit costs from a cost CSV file
+// Cost files are small, so unlike the sales refresh the load runs before responding
+func (h *AnalyticsHandler) LoadProductCosts(w http.ResponseWriter, r *http.Request) {
+	var requestBody struct {
+		FilePath string `json:"file_path"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&requestBody); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if requestBody.FilePath == "" {
+		RespondWithError(w, http.StatusBadRequest, "File path is required")
+		return
+	}
+
+	rowsProcessed, err := h.dataLoader.LoadProductCosts(r.Context(), requestBody.FilePath)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Failed to load product costs: "+err.Error())
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message":        "Product costs loaded successfully",
+		"rows_processed": rowsProcessed,
+	})
+}
+
+// LoadHierarchyMapping handles loading the location or category hierarchy mapping from a CSV file
+func (h *AnalyticsHandler) LoadHierarchyMapping(w http.ResponseWriter, r *http.Request) {
+	var requestBody struct {
+		Hierarchy string `json:"hierarchy"`
+		FilePath  string `json:"file_path"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&requestBody); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if requestBody.FilePath == "" {
+		RespondWithError(w, http.StatusBadRequest, "File path is required")
+		return
+	}
+
+	if _, err := services.HierarchyLevels(requestBody.Hierarchy); err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rowsProcessed, err := h.dataLoader.LoadHierarchyMapping(r.Context(), requestBody.Hierarchy, requestBody.FilePath)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Failed to load hierarchy mapping: "+err.Error())
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message":        "Hierarchy mapping loaded successfully",
+		"hierarchy":      requestBody.Hierarchy,
+		"rows_processed": rowsProcessed,
 	})
 }
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/prajwalbharadwajbm/backend_assessment/internal/services"
+)
+
+// Number of customers returned by the top customers endpoint when no limit is given
+const defaultTopCustomers = 10
+
+// validateGroupBy checks the group_by parameter of the customer endpoints
+func validateGroupBy(r *http.Request) (string, bool) {
+	groupBy := r.URL.Query().Get("group_by")
+	if groupBy == "" {
+		groupBy = "customer"
+	}
+	return groupBy, groupBy == "customer" || groupBy == "master"
+}
+
+// GetTopCustomers handles requests for the top customers by revenue, orders or average order value
+func (h *AnalyticsHandler) GetTopCustomers(w http.ResponseWriter, r *http.Request) {
+	rankBy := r.URL.Query().Get("rank_by")
+	if rankBy == "" {
+		rankBy = "revenue"
+	}
+
+	if rankBy != "revenue" && rankBy != "orders" && rankBy != "average_order_value" {
+		RespondWithError(w, http.StatusBadRequest, "invalid rank_by: must be 'revenue', 'orders' or 'average_order_value'")
+		return
+	}
+
+	groupBy, ok := validateGroupBy(r)
+	if !ok {
+		RespondWithError(w, http.StatusBadRequest, "invalid group_by: must be 'customer' or 'master'")
+		return
+	}
+
+	filter, err := parseCustomerFilter(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if filter.Limit == 0 {
+		filter.Limit = defaultTopCustomers
+	}
+
+	customers, err := h.analyticsService.GetTopCustomers(r.Context(), filter, rankBy, groupBy)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to get top customers: "+err.Error())
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"start_date": filter.StartDate,
+		"end_date":   filter.EndDate,
+		"rank_by":    rankBy,
+		"group_by":   groupBy,
+		"data":       customers,
+	})
+}
+
+// GetCustomerLifetimeValue handles requests for customer lifetime value and purchase behaviour
+func (h *AnalyticsHandler) GetCustomerLifetimeValue(w http.ResponseWriter, r *http.Request) {
+	groupBy, ok := validateGroupBy(r)
+	if !ok {
+		RespondWithError(w, http.StatusBadRequest, "invalid group_by: must be 'customer' or 'master'")
+		return
+	}
+
+	filter, err := parseCustomerFilter(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	customers, summary, err := h.analyticsService.GetCustomerLifetimeValue(r.Context(), filter, groupBy)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to calculate customer lifetime value: "+err.Error())
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"start_date": filter.StartDate,
+		"end_date":   filter.EndDate,
+		"group_by":   groupBy,
+		"summary":    summary,
+		"data":       customers,
+	})
+}
+
+// GetRFMScores handles requests for customer RFM scores and segments, recomputed after every refresh
+func (h *AnalyticsHandler) GetRFMScores(w http.ResponseWriter, r *http.Request) {
+	segments := queryValues(r, "segment")
+	for _, segment := range segments {
+		if !slices.Contains(services.RFMSegments, segment) {
+			RespondWithError(w, http.StatusBadRequest, "invalid segment: must be one of "+strings.Join(services.RFMSegments, ", "))
+			return
+		}
+	}
+
+	limit := 0
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		var err error
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 0 {
+			RespondWithError(w, http.StatusBadRequest, "invalid limit: must be a positive number")
+			return
+		}
+	}
+
+	customers, summary, err := h.analyticsService.GetRFMScores(r.Context(), segments, limit)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to get rfm scores: "+err.Error())
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"segments": summary,
+		"data":     customers,
+	})
+}
+
+// GetChurnScores handles requests for customer churn risk scores, recomputed after every refresh
+func (h *AnalyticsHandler) GetChurnScores(w http.ResponseWriter, r *http.Request) {
+	risks := queryValues(r, "risk")
+	for _, risk := range risks {
+		if !slices.Contains(services.ChurnRisks, risk) {
+			RespondWithError(w, http.StatusBadRequest, "invalid risk: must be one of "+strings.Join(services.ChurnRisks, ", "))
+			return
+		}
+	}
+
+	limit := 0
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		var err error
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 0 {
+			RespondWithError(w, http.StatusBadRequest, "invalid limit: must be a positive number")
+			return
+		}
+	}
+
+	customers, summary, err := h.analyticsService.GetChurnScores(r.Context(), risks, limit)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to get churn scores: "+err.Error())
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"risks": summary,
+		"data":  customers,
+	})
+}
+
+// GetCohortRetention handles requests for the cohort retention matrix
+// interval takes the same values as the revenue over time endpoint
+func (h *AnalyticsHandler) GetCohortRetention(w http.ResponseWriter, r *http.Request) {
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = "monthly"
+	}
+
+	filter, err := parseFilter(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	cohorts, err := h.analyticsService.GetCohortRetention(r.Context(), filter, interval)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to calculate cohort retention: "+err.Error())
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"start_date": filter.StartDate,
+		"end_date":   filter.EndDate,
+		"interval":   interval,
+		"data":       cohorts,
+	})
+}
+
+// GetNewVsReturning handles requests for the revenue split between new and returning customers
+// breakdown is "time" (by interval, the default) or "region"
+func (h *AnalyticsHandler) GetNewVsReturning(w http.ResponseWriter, r *http.Request) {
+	breakdown := r.URL.Query().Get("breakdown")
+	if breakdown == "" {
+		breakdown = "time"
+	}
+
+	if breakdown != "time" && breakdown != "region" {
+		RespondWithError(w, http.StatusBadRequest, "invalid breakdown: must be 'time' or 'region'")
+		return
+	}
+
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = "monthly"
+	}
+
+	filter, err := parseFilter(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	split, err := h.analyticsService.GetNewVsReturningRevenue(r.Context(), filter, breakdown, interval)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to split new and returning customers: "+err.Error())
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"start_date": filter.StartDate,
+		"end_date":   filter.EndDate,
+		"breakdown":  breakdown,
+		"interval":   interval,
+		"data":       split,
+	})
+}
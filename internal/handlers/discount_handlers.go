@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/prajwalbharadwajbm/backend_assessment/internal/services"
+)
+
+// GetRevenueByDiscountBand handles requests for revenue and units by discount band
+// bands takes the lower edges of the bands as fractions, e.g. bands=0.1,0.25,0.5
+func (h *AnalyticsHandler) GetRevenueByDiscountBand(w http.ResponseWriter, r *http.Request) {
+	edges := services.DefaultDiscountBands
+	if values := queryValues(r, "bands"); len(values) > 0 {
+		edges = make([]float64, 0, len(values))
+		for _, value := range values {
+			edge, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				RespondWithError(w, http.StatusBadRequest, "invalid bands: must be discount fractions such as 0.1,0.25")
+				return
+			}
+			edges = append(edges, edge)
+		}
+	}
+
+	if err := services.ValidateDiscountBands(edges); err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter, err := parseFilter(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	bands, err := h.analyticsService.GetRevenueByDiscountBand(r.Context(), filter, edges)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to get revenue by discount band: "+err.Error())
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"start_date": filter.StartDate,
+		"end_date":   filter.EndDate,
+		"bands":      edges,
+		"data":       bands,
+	})
+}
+
+// GetDiscountLeakage handles requests for revenue given away through discounts
+func (h *AnalyticsHandler) GetDiscountLeakage(w http.ResponseWriter, r *http.Request) {
+	groupBy := r.URL.Query().Get("group_by")
+	if groupBy == "" {
+		groupBy = "product"
+	}
+
+	if groupBy != "product" && groupBy != "category" && groupBy != "region" {
+		RespondWithError(w, http.StatusBadRequest, "invalid group_by: must be 'product', 'category' or 'region'")
+		return
+	}
+
+	filter, err := parseFilter(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	leakage, err := h.analyticsService.GetDiscountLeakage(r.Context(), filter, groupBy)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to get discount leakage: "+err.Error())
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"start_date": filter.StartDate,
+		"end_date":   filter.EndDate,
+		"group_by":   groupBy,
+		"data":       leakage,
+	})
+}
+
+// GetDiscountQuantityRelationship handles requests for how discount levels relate to quantity sold per product
+func (h *AnalyticsHandler) GetDiscountQuantityRelationship(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseFilter(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	products, err := h.analyticsService.GetDiscountQuantityRelationship(r.Context(), filter)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to get discount and quantity relationship: "+err.Error())
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"start_date": filter.StartDate,
+		"end_date":   filter.EndDate,
+		"data":       products,
+	})
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/prajwalbharadwajbm/backend_assessment/internal/models"
+	"github.com/prajwalbharadwajbm/backend_assessment/internal/services"
+)
+
+// queryValues collects a multi-valued query parameter
+// Accepts both repeated parameters (?region=Europe&region=Asia) and comma separated values (?region=Europe,Asia)
+func queryValues(r *http.Request, key string) []string {
+	var values []string
+	for _, raw := range r.URL.Query()[key] {
+		for _, value := range strings.Split(raw, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+// parseFilter builds the filter shared by the revenue endpoints from the query string
+func parseFilter(r *http.Request) (models.Filter, error) {
+	var f models.Filter
+	var err error
+
+	f.StartDate, f.EndDate, err = validateDateRange(r.URL.Query().Get("start_date"), r.URL.Query().Get("end_date"))
+	if err != nil {
+		return f, err
+	}
+
+	f.AsOf, err = validateAsOf(r.URL.Query().Get("as_of"))
+	if err != nil {
+		return f, err
+	}
+
+	f.RevenueBasis, err = validateRevenueBasis(r.URL.Query().Get("revenue_basis"))
+	if err != nil {
+		return f, err
+	}
+
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		f.Limit, err = strconv.Atoi(limit)
+		if err != nil || f.Limit < 0 {
+			return f, errors.New("invalid limit: must be a positive number")
+		}
+	}
+
+	f.Categories = queryValues(r, "category")
+	f.Regions = queryValues(r, "region")
+	f.ProductIDs = queryValues(r, "product_id")
+	f.CustomerIDs = queryValues(r, "customer_id")
+	f.PaymentMethods = queryValues(r, "payment_method")
+
+	return f, nil
+}
+
+// parseCustomerFilter is parseFilter for the customer endpoints. Customer attributes are always the
+// current ones, so as_of=sale is rejected rather than silently ignored.
+func parseCustomerFilter(r *http.Request) (models.Filter, error) {
+	f, err := parseFilter(r)
+	if err != nil {
+		return f, err
+	}
+
+	if f.AsOf == services.AttributesAtSale {
+		return f, errors.New("invalid as_of: customer endpoints only report current customer attributes, as_of=sale isn't supported")
+	}
+
+	return f, nil
+}
+
+// parseComparison returns the filter for the period to compare against, or nil when compare isn't set
+// compare=custom takes the period from compare_start_date and compare_end_date
+func parseComparison(r *http.Request, f models.Filter) (*models.Filter, error) {
+	mode := r.URL.Query().Get("compare")
+	if mode == "" {
+		return nil, nil
+	}
+
+	comparison, err := services.ComparisonFilter(f, mode, r.URL.Query().Get("compare_start_date"), r.URL.Query().Get("compare_end_date"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &comparison, nil
+}
+
+// comparisonPeriod describes the comparison period in responses
+func comparisonPeriod(r *http.Request, comparison *models.Filter) map[string]string {
+	return map[string]string{
+		"mode":       r.URL.Query().Get("compare"),
+		"start_date": comparison.StartDate,
+		"end_date":   comparison.EndDate,
+	}
+}
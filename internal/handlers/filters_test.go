@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/prajwalbharadwajbm/backend_assessment/internal/services"
+)
+
+func TestQueryValues(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", nil},
+		{"region=Europe", []string{"Europe"}},
+		{"region=Europe&region=Asia", []string{"Europe", "Asia"}},
+		{"region=Europe,Asia", []string{"Europe", "Asia"}},
+		{"region=Europe,%20Asia&region=North%20America", []string{"Europe", "Asia", "North America"}},
+		{"region=,Europe,,&region=", []string{"Europe"}},
+		{"category=Books", nil},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/api/revenue?"+tt.query, nil)
+		if got := queryValues(r, "region"); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("queryValues(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	r := httptest.NewRequest("GET", "/api/revenue?start_date=2024-01-01&end_date=2024-06-30"+
+		"&category=Books,Toys&region=Europe&product_id=P1&product_id=P2&customer_id=C1"+
+		"&payment_method=Card&limit=5&as_of=sale&revenue_basis=with_shipping", nil)
+
+	f, err := parseFilter(r)
+	if err != nil {
+		t.Fatalf("parseFilter: %v", err)
+	}
+
+	if f.StartDate != "2024-01-01" || f.EndDate != "2024-06-30" {
+		t.Errorf("date range = %s to %s, want 2024-01-01 to 2024-06-30", f.StartDate, f.EndDate)
+	}
+	if !reflect.DeepEqual(f.Categories, []string{"Books", "Toys"}) {
+		t.Errorf("Categories = %q", f.Categories)
+	}
+	if !reflect.DeepEqual(f.Regions, []string{"Europe"}) {
+		t.Errorf("Regions = %q", f.Regions)
+	}
+	if !reflect.DeepEqual(f.ProductIDs, []string{"P1", "P2"}) {
+		t.Errorf("ProductIDs = %q", f.ProductIDs)
+	}
+	if !reflect.DeepEqual(f.CustomerIDs, []string{"C1"}) {
+		t.Errorf("CustomerIDs = %q", f.CustomerIDs)
+	}
+	if !reflect.DeepEqual(f.PaymentMethods, []string{"Card"}) {
+		t.Errorf("PaymentMethods = %q", f.PaymentMethods)
+	}
+	if f.Limit != 5 {
+		t.Errorf("Limit = %d, want 5", f.Limit)
+	}
+	if f.AsOf != services.AttributesAtSale {
+		t.Errorf("AsOf = %q, want %q", f.AsOf, services.AttributesAtSale)
+	}
+	if f.RevenueBasis != services.RevenueWithShipping {
+		t.Errorf("RevenueBasis = %q, want %q", f.RevenueBasis, services.RevenueWithShipping)
+	}
+}
+
+func TestParseFilterDefaults(t *testing.T) {
+	f, err := parseFilter(httptest.NewRequest("GET", "/api/revenue", nil))
+	if err != nil {
+		t.Fatalf("parseFilter: %v", err)
+	}
+
+	if f.StartDate == "" || f.EndDate == "" {
+		t.Errorf("date range = %q to %q, want both defaulted", f.StartDate, f.EndDate)
+	}
+	if f.AsOf != services.AttributesCurrent {
+		t.Errorf("AsOf = %q, want %q", f.AsOf, services.AttributesCurrent)
+	}
+	if f.RevenueBasis != services.RevenueProduct {
+		t.Errorf("RevenueBasis = %q, want %q", f.RevenueBasis, services.RevenueProduct)
+	}
+	if f.Limit != 0 || f.Categories != nil || f.Regions != nil {
+		t.Errorf("filter = %+v, want no limit or attribute filters", f)
+	}
+}
+
+func TestParseFilterInvalid(t *testing.T) {
+	tests := []string{
+		"limit=ten",
+		"limit=-1",
+		"as_of=yesterday",
+		"revenue_basis=gross",
+	}
+
+	for _, query := range tests {
+		if _, err := parseFilter(httptest.NewRequest("GET", "/api/revenue?"+query, nil)); err == nil {
+			t.Errorf("parseFilter(%q) succeeded, want an error", query)
+		}
+	}
+}
+
+func TestParseCustomerFilter(t *testing.T) {
+	if _, err := parseCustomerFilter(httptest.NewRequest("GET", "/api/customers/top?as_of=current&region=Europe", nil)); err != nil {
+		t.Errorf("parseCustomerFilter with as_of=current: %v", err)
+	}
+	if _, err := parseCustomerFilter(httptest.NewRequest("GET", "/api/customers/top?as_of=sale", nil)); err == nil {
+		t.Error("parseCustomerFilter with as_of=sale succeeded, want an error")
+	}
+	if _, err := parseCustomerFilter(httptest.NewRequest("GET", "/api/customers/top?limit=-1", nil)); err == nil {
+		t.Error("parseCustomerFilter with a bad limit succeeded, want an error")
+	}
+}
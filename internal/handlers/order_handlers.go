@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/prajwalbharadwajbm/backend_assessment/internal/services"
+)
+
+// GetOrderDistribution handles requests for the distribution of order values or basket sizes
+// percentiles takes values between 0 and 100 with an optional p prefix, e.g. percentiles=p90,p99
+func (h *AnalyticsHandler) GetOrderDistribution(w http.ResponseWriter, r *http.Request) {
+	metric := r.URL.Query().Get("metric")
+	if metric == "" {
+		metric = services.DistributionOrderValue
+	}
+
+	bins := defaultDistributionBins
+	if raw := r.URL.Query().Get("bins"); raw != "" {
+		var err error
+		bins, err = strconv.Atoi(raw)
+		if err != nil || bins < 1 || bins > maxDistributionBins {
+			RespondWithError(w, http.StatusBadRequest, "invalid bins: must be between 1 and "+strconv.Itoa(maxDistributionBins))
+			return
+		}
+	}
+
+	percentiles := services.DefaultPercentiles
+	if values := queryValues(r, "percentiles"); len(values) > 0 {
+		percentiles = make([]float64, 0, len(values))
+		for _, value := range values {
+			p, err := strconv.ParseFloat(strings.TrimPrefix(strings.ToLower(value), "p"), 64)
+			if err != nil {
+				RespondWithError(w, http.StatusBadRequest, "invalid percentiles: must be numbers between 0 and 100 such as 90,99 or p90,p99")
+				return
+			}
+			percentiles = append(percentiles, p)
+		}
+	}
+
+	if err := services.ValidateDistribution(metric, bins, percentiles); err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter, err := parseFilter(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	summary, histogram, err := h.analyticsService.GetOrderDistribution(r.Context(), filter, metric, bins, percentiles)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to get order distribution: "+err.Error())
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"start_date": filter.StartDate,
+		"end_date":   filter.EndDate,
+		"bins":       bins,
+		"summary":    summary,
+		"histogram":  histogram,
+	})
+}
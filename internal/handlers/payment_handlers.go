@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+)
+
+// GetPaymentMix handles requests for the payment method mix over time by region
+func (h *AnalyticsHandler) GetPaymentMix(w http.ResponseWriter, r *http.Request) {
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = "monthly"
+	}
+
+	filter, err := parseFilter(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	mix, err := h.analyticsService.GetPaymentMixOverTime(r.Context(), filter, interval)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to calculate payment mix: "+err.Error())
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"start_date": filter.StartDate,
+		"end_date":   filter.EndDate,
+		"interval":   interval,
+		"data":       mix,
+	})
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/prajwalbharadwajbm/backend_assessment/internal/services"
+)
+
+const (
+	// Default minimum share of orders a product pair must appear in
+	defaultMinSupport = 0.01
+	// Number of product pairs returned when no limit is given
+	defaultAffinityPairs = 50
+)
+
+// GetProductAffinity handles requests for products frequently bought together
+func (h *AnalyticsHandler) GetProductAffinity(w http.ResponseWriter, r *http.Request) {
+	minSupport := defaultMinSupport
+	if raw := r.URL.Query().Get("min_support"); raw != "" {
+		var err error
+		minSupport, err = strconv.ParseFloat(raw, 64)
+		if err != nil || minSupport <= 0 || minSupport > 1 {
+			RespondWithError(w, http.StatusBadRequest, "invalid min_support: must be greater than 0 and at most 1")
+			return
+		}
+	}
+
+	filter, err := parseFilter(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if filter.Limit == 0 {
+		filter.Limit = defaultAffinityPairs
+	}
+
+	pairs, err := h.analyticsService.GetProductAffinity(r.Context(), filter, minSupport)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to calculate product affinity: "+err.Error())
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"start_date":  filter.StartDate,
+		"end_date":    filter.EndDate,
+		"min_support": minSupport,
+		"data":        pairs,
+	})
+}
+
+// GetProductABC handles requests for the ABC (Pareto) classification of products by revenue
+// a_threshold and b_threshold are the cumulative revenue shares closing the A and B tiers
+func (h *AnalyticsHandler) GetProductABC(w http.ResponseWriter, r *http.Request) {
+	thresholds := map[string]float64{
+		"a_threshold": services.DefaultABCThresholdA,
+		"b_threshold": services.DefaultABCThresholdB,
+	}
+	for name := range thresholds {
+		raw := r.URL.Query().Get(name)
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, "invalid "+name+": must be a share between 0 and 1")
+			return
+		}
+		thresholds[name] = value
+	}
+
+	thresholdA, thresholdB := thresholds["a_threshold"], thresholds["b_threshold"]
+	if err := services.ValidateABCThresholds(thresholdA, thresholdB); err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter, err := parseFilter(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	products, summary, err := h.analyticsService.GetProductABC(r.Context(), filter, thresholdA, thresholdB)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to classify products: "+err.Error())
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"start_date":  filter.StartDate,
+		"end_date":    filter.EndDate,
+		"a_threshold": thresholdA,
+		"b_threshold": thresholdB,
+		"summary":     summary,
+		"data":        products,
+	})
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/prajwalbharadwajbm/backend_assessment/internal/models"
+	"github.com/prajwalbharadwajbm/backend_assessment/internal/services"
+)
+
+// RunQuery handles generic dimension/measure queries posted as JSON
+func (h *AnalyticsHandler) RunQuery(w http.ResponseWriter, r *http.Request) {
+	var query models.AnalyticsQuery
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&query); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload: "+err.Error())
+		return
+	}
+
+	if query.TimeGrain == "" {
+		query.TimeGrain = "monthly"
+	}
+
+	var err error
+	query.Filters.StartDate, query.Filters.EndDate, err = validateDateRange(query.Filters.StartDate, query.Filters.EndDate)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	query.Filters.AsOf, err = validateAsOf(query.Filters.AsOf)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	results, err := h.analyticsService.RunQuery(r.Context(), query)
+	if errors.Is(err, services.ErrInvalidQuery) {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to run query: "+err.Error())
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"query": query,
+		"data":  results,
+	})
+}
+
+// RunPivot handles pivot queries, a measure cross-tabulated over two dimensions, posted as JSON
+func (h *AnalyticsHandler) RunPivot(w http.ResponseWriter, r *http.Request) {
+	var query models.PivotQuery
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&query); err != nil {
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload: "+err.Error())
+		return
+	}
+
+	if query.TimeGrain == "" {
+		query.TimeGrain = "monthly"
+	}
+
+	if query.Measure == "" {
+		query.Measure = "revenue"
+	}
+
+	var err error
+	query.Filters.StartDate, query.Filters.EndDate, err = validateDateRange(query.Filters.StartDate, query.Filters.EndDate)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	query.Filters.AsOf, err = validateAsOf(query.Filters.AsOf)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pivot, err := h.analyticsService.RunPivot(r.Context(), query)
+	if errors.Is(err, services.ErrInvalidQuery) {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to run pivot: "+err.Error())
+		return
+	}
+
+	pivot["query"] = query
+	RespondWithJSON(w, http.StatusOK, pivot)
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/http"
+)
+
+// GetShippingCosts handles requests for shipping cost totals and shipping as a share of revenue
+func (h *AnalyticsHandler) GetShippingCosts(w http.ResponseWriter, r *http.Request) {
+	groupBy := r.URL.Query().Get("group_by")
+	if groupBy == "" {
+		groupBy = "region"
+	}
+
+	if groupBy != "region" && groupBy != "payment_method" {
+		RespondWithError(w, http.StatusBadRequest, "invalid group_by: must be 'region' or 'payment_method'")
+		return
+	}
+
+	filter, err := parseFilter(r)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	costs, summary, err := h.analyticsService.GetShippingCosts(r.Context(), filter, groupBy)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Failed to get shipping costs: "+err.Error())
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"start_date": filter.StartDate,
+		"end_date":   filter.EndDate,
+		"group_by":   groupBy,
+		"summary":    summary,
+		"data":       costs,
+	})
+}
@@ -1,14 +1,28 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 )
 
 type Customer struct {
-	CustomerID string `json:"customer_id"`
-	Name       string `json:"name"`
-	Email      string `json:"email"`
-	Address    string `json:"address"`
+	CustomerID       string  `json:"customer_id"`
+	Name             string  `json:"name"`
+	Email            string  `json:"email"`
+	Address          string  `json:"address"`
+	MasterCustomerID *string `json:"master_customer_id"`
+}
+
+// CustomerIdentityConflict records a customer ID that was linked to a master customer
+// because it shared an email or normalized name and address with another customer
+type CustomerIdentityConflict struct {
+	ConflictID        int       `json:"conflict_id"`
+	CustomerID        string    `json:"customer_id"`
+	MatchedCustomerID string    `json:"matched_customer_id"`
+	MasterCustomerID  string    `json:"master_customer_id"`
+	MatchReason       string    `json:"match_reason"`
+	LogID             *int      `json:"log_id"`
+	DetectedAt        time.Time `json:"detected_at"`
 }
 
 type Product struct {
@@ -34,6 +48,9 @@ type Order struct {
 	SaleDate        time.Time `json:"sale_date"`
 	ShippingCost    float64   `json:"shipping_cost"`
 	PaymentMethodID int       `json:"payment_method_id"`
+	SourceID        *int      `json:"source_id"`
+	SourceLine      *int      `json:"source_line"`
+	LogID           *int      `json:"log_id"`
 }
 
 type OrderItem struct {
@@ -43,6 +60,17 @@ type OrderItem struct {
 	Quantity    int     `json:"quantity"`
 	UnitPrice   float64 `json:"unit_price"`
 	Discount    float64 `json:"discount"`
+	SourceID    *int    `json:"source_id"`
+	SourceLine  *int    `json:"source_line"`
+	LogID       *int    `json:"log_id"`
+}
+
+// DataSource is a CSV file that has been loaded, identified by name and content checksum
+type DataSource struct {
+	SourceID      int       `json:"source_id"`
+	FileName      string    `json:"file_name"`
+	FileChecksum  string    `json:"file_checksum"`
+	FirstLoadedAt time.Time `json:"first_loaded_at"`
 }
 
 type DataRefreshLog struct {
@@ -53,12 +81,50 @@ type DataRefreshLog struct {
 	RowsProcessed int        `json:"rows_processed"`
 	ErrorMessage  *string    `json:"error_message"`
 	TriggeredBy   string     `json:"triggered_by"`
+	SourceID      *int       `json:"source_id"`
+	// ReconciliationStatus is MATCHED or MISMATCHED once the loaded rows were checked against the file
+	ReconciliationStatus *string         `json:"reconciliation_status"`
+	Reconciliation       json.RawMessage `json:"reconciliation,omitempty"`
 }
 
+// Filter narrows down analytics queries, each multi-valued field matches any of its values
 type Filter struct {
-	StartDate string `json:"start_date"`
-	EndDate   string `json:"end_date"`
-	Category  string `json:"category,omitempty"`
-	Region    string `json:"region,omitempty"`
-	Limit     int    `json:"limit,omitempty"`
+	StartDate      string   `json:"start_date"`
+	EndDate        string   `json:"end_date"`
+	Categories     []string `json:"category,omitempty"`
+	Regions        []string `json:"region,omitempty"`
+	ProductIDs     []string `json:"product_id,omitempty"`
+	CustomerIDs    []string `json:"customer_id,omitempty"`
+	PaymentMethods []string `json:"payment_method,omitempty"`
+	Limit          int      `json:"limit,omitempty"`
+	// AsOf is "current" or "sale", see services.AttributesCurrent
+	AsOf string `json:"as_of,omitempty"`
+	// RevenueBasis is "product", "with_shipping" or "net_of_shipping", see services.RevenueProduct
+	RevenueBasis string `json:"revenue_basis,omitempty"`
+}
+
+// AnalyticsQuery is a generic dimension/measure query, see services.AnalyticsService.RunQuery
+type AnalyticsQuery struct {
+	Dimensions []string    `json:"dimensions"`
+	Measures   []string    `json:"measures"`
+	TimeGrain  string      `json:"time_grain,omitempty"`
+	Filters    Filter      `json:"filters"`
+	Sort       []SortField `json:"sort,omitempty"`
+	Limit      int         `json:"limit,omitempty"`
+}
+
+// PivotQuery is a measure cross-tabulated over two dimensions, see services.AnalyticsService.RunPivot
+type PivotQuery struct {
+	Rows      string `json:"rows"`
+	Columns   string `json:"columns"`
+	Measure   string `json:"measure"`
+	TimeGrain string `json:"time_grain,omitempty"`
+	Filters   Filter `json:"filters"`
+	// Normalize is "", "total", "row" or "column", see services.PivotNormalizeTotal
+	Normalize string `json:"normalize,omitempty"`
+}
+
+type SortField struct {
+	Field     string `json:"field"`
+	Direction string `json:"direction"`
 }
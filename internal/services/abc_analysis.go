@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/prajwalbharadwajbm/backend_assessment/internal/models"
+)
+
+// Default cumulative revenue shares closing the A and B tiers, the rest of the long tail is C
+const (
+	DefaultABCThresholdA = 0.8
+	DefaultABCThresholdB = 0.95
+)
+
+// ValidateABCThresholds checks that the A threshold comes before the B threshold and both are shares
+func ValidateABCThresholds(thresholdA, thresholdB float64) error {
+	if thresholdA <= 0 || thresholdB >= 1 || thresholdA >= thresholdB {
+		return errors.New("invalid thresholds: must satisfy 0 < a_threshold < b_threshold < 1")
+	}
+	return nil
+}
+
+// abcTier places a product by the cumulative revenue share of the products ranked above it,
+// so the product that crosses a threshold still belongs to the higher tier
+func abcTier(shareBefore, thresholdA, thresholdB float64) string {
+	switch {
+	case shareBefore < thresholdA:
+		return "A"
+	case shareBefore < thresholdB:
+		return "B"
+	default:
+		return "C"
+	}
+}
+
+// GetProductABC ranks products by revenue and classifies them into A, B and C tiers by cumulative revenue share.
+// Every product matching the filter is ranked, f.Limit only caps the products returned.
+// The summary has the number of products and revenue in each tier.
+func (as *AnalyticsService) GetProductABC(ctx context.Context, f models.Filter, thresholdA, thresholdB float64) ([]map[string]interface{}, []map[string]interface{}, error) {
+	if err := ValidateABCThresholds(thresholdA, thresholdB); err != nil {
+		return nil, nil, err
+	}
+
+	from, err := revenueFrom(f.AsOf)
+	if err != nil {
+		return nil, nil, err
+	}
+	revenueSQL, err := revenueMeasure(f.RevenueBasis)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	qa := &queryArgs{}
+	query := `
+		WITH product_revenue AS (
+			SELECT
+				p.product_id,
+				` + latestProductAttribute("p.name") + ` as name,
+				` + latestProductAttribute("p.category") + ` as category,
+				COALESCE(SUM(` + revenueSQL + `), 0) as revenue
+			` + from + `
+			` + whereClause(f, qa) + `
+			GROUP BY p.product_id
+		)
+		SELECT
+			product_id,
+			name,
+			category,
+			revenue,
+			SUM(revenue) OVER (ORDER BY revenue DESC, product_id ROWS UNBOUNDED PRECEDING) as cumulative_revenue,
+			SUM(revenue) OVER () as total_revenue,
+			COUNT(*) OVER () as product_count
+		FROM product_revenue
+		ORDER BY revenue DESC, product_id
+	`
+
+	rows, err := as.db.QueryContext(ctx, query, qa.values...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var products []map[string]interface{}
+	tiers := map[string]map[string]interface{}{}
+	var totalRevenue float64
+	var productCount int
+
+	for rank := 1; rows.Next(); rank++ {
+		var productID, name, category string
+		var revenue, cumulativeRevenue float64
+
+		if err := rows.Scan(&productID, &name, &category, &revenue, &cumulativeRevenue, &totalRevenue, &productCount); err != nil {
+			return nil, nil, err
+		}
+
+		var revenueShare, cumulativeShare, shareBefore float64
+		if totalRevenue != 0 {
+			revenueShare = revenue / totalRevenue
+			cumulativeShare = cumulativeRevenue / totalRevenue
+			shareBefore = (cumulativeRevenue - revenue) / totalRevenue
+		}
+		tier := abcTier(shareBefore, thresholdA, thresholdB)
+
+		if tiers[tier] == nil {
+			tiers[tier] = map[string]interface{}{"tier": tier, "products": 0, "revenue": 0.0}
+		}
+		tiers[tier]["products"] = tiers[tier]["products"].(int) + 1
+		tiers[tier]["revenue"] = tiers[tier]["revenue"].(float64) + revenue
+
+		if f.Limit > 0 && rank > f.Limit {
+			continue
+		}
+
+		products = append(products, map[string]interface{}{
+			"rank":                   rank,
+			"product_id":             productID,
+			"name":                   name,
+			"category":               category,
+			"revenue":                revenue,
+			"revenue_pct":            revenueShare * 100,
+			"cumulative_revenue":     cumulativeRevenue,
+			"cumulative_pct":         cumulativeShare * 100,
+			"cumulative_product_pct": float64(rank) / float64(productCount) * 100,
+			"tier":                   tier,
+		})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var summary []map[string]interface{}
+	for _, name := range []string{"A", "B", "C"} {
+		tier, ok := tiers[name]
+		if !ok {
+			continue
+		}
+		tier["revenue_pct"] = 0.0
+		if totalRevenue != 0 {
+			tier["revenue_pct"] = tier["revenue"].(float64) / totalRevenue * 100
+		}
+		tier["product_pct"] = float64(tier["products"].(int)) / float64(productCount) * 100
+		summary = append(summary, tier)
+	}
+
+	return products, summary, nil
+}
@@ -3,8 +3,20 @@ package services
 import (
 	"context"
 	"errors"
+	"strconv"
 
 	"github.com/prajwalbharadwajbm/backend_assessment/internal/database"
+	"github.com/prajwalbharadwajbm/backend_assessment/internal/models"
+)
+
+// Attribute modes for product attributes in analytics.
+// AttributesCurrent reports every sale with today's attributes,
+// AttributesAtSale uses the version from product_history that was valid on the sale date.
+// Customer attributes are always the current ones, customer_history is kept as an audit trail,
+// so the customer endpoints reject AttributesAtSale.
+const (
+	AttributesCurrent = "current"
+	AttributesAtSale  = "sale"
 )
 
 type AnalyticsService struct {
@@ -15,17 +27,75 @@ func NewAnalyticsService(db *database.DB) *AnalyticsService {
 	return &AnalyticsService{db: db}
 }
 
-// GetRevenueByDateRange calculates total revenue within the given date range
-func (as *AnalyticsService) GetRevenueByDateRange(ctx context.Context, startDate, endDate string) (float64, error) {
+// productSource returns the join that resolves product attributes for order items as p
+// Expects order_items as oi and orders as o to be in the query already
+func productSource(asOf string) (string, error) {
+	switch asOf {
+	case AttributesCurrent, "":
+		return `JOIN products p ON p.product_id = oi.product_id`, nil
+	case AttributesAtSale:
+		return `JOIN product_history p ON p.product_id = oi.product_id
+			AND o.sale_date >= p.valid_from
+			AND (p.valid_to IS NULL OR o.sale_date < p.valid_to)`, nil
+	default:
+		return "", errors.New("invalid as_of: must be 'current' or 'sale'")
+	}
+}
+
+// latestProductAttribute picks a product attribute for rows grouped by product ID: the version on the
+// latest sale in the group. With AttributesAtSale a product renamed within the range would otherwise come
+// back once per name. Only one version is valid on a sale date, so the pick is deterministic.
+func latestProductAttribute(column string) string {
+	return "(ARRAY_AGG(" + column + " ORDER BY o.sale_date DESC))[1]"
+}
+
+// timeBucket maps an interval to the DATE_TRUNC unit and the TO_CHAR format of its periods
+func timeBucket(interval string) (string, string, error) {
+	switch interval {
+	case "daily":
+		return "day", "YYYY-MM-DD", nil
+	case "weekly":
+		return "week", "IYYY-\"W\"IW", nil // ISO weeks, starting on Monday
+	case "monthly":
+		return "month", "YYYY-MM", nil
+	case "quarterly":
+		return "quarter", "YYYY-\"Q\"Q", nil
+	case "yearly":
+		return "year", "YYYY", nil
+	default:
+		return "", "", errors.New("invalid interval: must be 'daily', 'weekly', 'monthly', 'quarterly', or 'yearly'")
+	}
+}
+
+// bucketStep returns the interval between two consecutive periods of a DATE_TRUNC unit
+func bucketStep(unit string) string {
+	if unit == "quarter" {
+		return "3 months"
+	}
+	return "1 " + unit
+}
+
+// GetRevenueByDateRange calculates total revenue matching the filter
+func (as *AnalyticsService) GetRevenueByDateRange(ctx context.Context, f models.Filter) (float64, error) {
+	from, err := revenueFrom(f.AsOf)
+	if err != nil {
+		return 0, err
+	}
+
+	revenueSQL, err := revenueMeasure(f.RevenueBasis)
+	if err != nil {
+		return 0, err
+	}
+
+	qa := &queryArgs{}
 	query := `
-		SELECT COALESCE(SUM((oi.unit_price * oi.quantity) * (1 - oi.discount)), 0) as total_revenue
-		FROM order_items oi
-		JOIN orders o ON oi.order_id = o.order_id
-		WHERE o.sale_date BETWEEN $1 AND $2
+		SELECT COALESCE(SUM(` + revenueSQL + `), 0) as total_revenue
+		` + from + `
+		` + whereClause(f, qa) + `
 	`
 
 	var totalRevenue float64
-	err := as.db.QueryRowContext(ctx, query, startDate, endDate).Scan(&totalRevenue)
+	err = as.db.QueryRowContext(ctx, query, qa.values...).Scan(&totalRevenue)
 	if err != nil {
 		return 0, err
 	}
@@ -33,22 +103,33 @@ func (as *AnalyticsService) GetRevenueByDateRange(ctx context.Context, startDate
 	return totalRevenue, nil
 }
 
-// GetRevenueByProduct calculates revenue for each product within the given date range
-func (as *AnalyticsService) GetRevenueByProduct(ctx context.Context, startDate, endDate string) ([]map[string]interface{}, error) {
+// GetRevenueByProduct calculates revenue for each product matching the filter
+// f.AsOf picks whether product names are the current ones or the latest name sold under in the range
+func (as *AnalyticsService) GetRevenueByProduct(ctx context.Context, f models.Filter) ([]map[string]interface{}, error) {
+	from, err := revenueFrom(f.AsOf)
+	if err != nil {
+		return nil, err
+	}
+
+	revenueSQL, err := revenueMeasure(f.RevenueBasis)
+	if err != nil {
+		return nil, err
+	}
+
+	qa := &queryArgs{}
 	query := `
 		SELECT 
 			p.product_id,
-			p.name,
-			COALESCE(SUM((oi.unit_price * oi.quantity) * (1 - oi.discount)), 0) as revenue
-		FROM products p
-		JOIN order_items oi ON p.product_id = oi.product_id
-		JOIN orders o ON oi.order_id = o.order_id
-		WHERE o.sale_date BETWEEN $1 AND $2
-		GROUP BY p.product_id, p.name
+			` + latestProductAttribute("p.name") + ` as name,
+			COALESCE(SUM(` + revenueSQL + `), 0) as revenue
+		` + from + `
+		` + whereClause(f, qa) + `
+		GROUP BY p.product_id
 		ORDER BY revenue DESC
+		` + limitClause(f, qa) + `
 	`
 
-	rows, err := as.db.QueryContext(ctx, query, startDate, endDate)
+	rows, err := as.db.QueryContext(ctx, query, qa.values...)
 	if err != nil {
 		return nil, err
 	}
@@ -79,21 +160,32 @@ func (as *AnalyticsService) GetRevenueByProduct(ctx context.Context, startDate,
 	return results, nil
 }
 
-// GetRevenueByCategory calculates revenue for each category within the given date range
-func (as *AnalyticsService) GetRevenueByCategory(ctx context.Context, startDate, endDate string) ([]map[string]interface{}, error) {
+// GetRevenueByCategory calculates revenue for each category matching the filter
+// f.AsOf picks whether a sale counts towards the product's current category or the one it had when sold
+func (as *AnalyticsService) GetRevenueByCategory(ctx context.Context, f models.Filter) ([]map[string]interface{}, error) {
+	from, err := revenueFrom(f.AsOf)
+	if err != nil {
+		return nil, err
+	}
+
+	revenueSQL, err := revenueMeasure(f.RevenueBasis)
+	if err != nil {
+		return nil, err
+	}
+
+	qa := &queryArgs{}
 	query := `
 		SELECT 
 			p.category,
-			COALESCE(SUM((oi.unit_price * oi.quantity) * (1 - oi.discount)), 0) as revenue
-		FROM products p
-		JOIN order_items oi ON p.product_id = oi.product_id
-		JOIN orders o ON oi.order_id = o.order_id
-		WHERE o.sale_date BETWEEN $1 AND $2
+			COALESCE(SUM(` + revenueSQL + `), 0) as revenue
+		` + from + `
+		` + whereClause(f, qa) + `
 		GROUP BY p.category
 		ORDER BY revenue DESC
+		` + limitClause(f, qa) + `
 	`
 
-	rows, err := as.db.QueryContext(ctx, query, startDate, endDate)
+	rows, err := as.db.QueryContext(ctx, query, qa.values...)
 	if err != nil {
 		return nil, err
 	}
@@ -122,21 +214,32 @@ func (as *AnalyticsService) GetRevenueByCategory(ctx context.Context, startDate,
 	return results, nil
 }
 
-// GetRevenueByRegion calculates revenue for each region within the given date range
-func (as *AnalyticsService) GetRevenueByRegion(ctx context.Context, startDate, endDate string) ([]map[string]interface{}, error) {
+// GetRevenueByRegion calculates revenue for each region matching the filter
+func (as *AnalyticsService) GetRevenueByRegion(ctx context.Context, f models.Filter) ([]map[string]interface{}, error) {
+	from, err := revenueFrom(f.AsOf)
+	if err != nil {
+		return nil, err
+	}
+
+	revenueSQL, err := revenueMeasure(f.RevenueBasis)
+	if err != nil {
+		return nil, err
+	}
+
+	qa := &queryArgs{}
 	query := `
 		SELECT 
 			r.name as region,
-			COALESCE(SUM((oi.unit_price * oi.quantity) * (1 - oi.discount)), 0) as revenue
-		FROM regions r
-		JOIN orders o ON r.region_id = o.region_id
-		JOIN order_items oi ON o.order_id = oi.order_id
-		WHERE o.sale_date BETWEEN $1 AND $2
+			COALESCE(SUM(` + revenueSQL + `), 0) as revenue
+		` + from + `
+		JOIN regions r ON r.region_id = o.region_id
+		` + whereClause(f, qa) + `
 		GROUP BY r.name
 		ORDER BY revenue DESC
+		` + limitClause(f, qa) + `
 	`
 
-	rows, err := as.db.QueryContext(ctx, query, startDate, endDate)
+	rows, err := as.db.QueryContext(ctx, query, qa.values...)
 	if err != nil {
 		return nil, err
 	}
@@ -165,37 +268,111 @@ func (as *AnalyticsService) GetRevenueByRegion(ctx context.Context, startDate, e
 	return results, nil
 }
 
-// GetRevenueOverTime calculates revenue trends over time within the given date range
-func (as *AnalyticsService) GetRevenueOverTime(ctx context.Context, startDate, endDate, interval string) ([]map[string]interface{}, error) {
-	var timeFormat string
-	var groupBy string
+// GetRevenueByPaymentMethod calculates revenue, order count and average order value for each payment method matching the filter
+func (as *AnalyticsService) GetRevenueByPaymentMethod(ctx context.Context, f models.Filter) ([]map[string]interface{}, error) {
+	from, err := revenueFrom(f.AsOf)
+	if err != nil {
+		return nil, err
+	}
+	revenueSQL, err := revenueMeasure(f.RevenueBasis)
+	if err != nil {
+		return nil, err
+	}
+
+	qa := &queryArgs{}
+	query := `
+		SELECT
+			pm.name as payment_method,
+			COALESCE(SUM(` + revenueSQL + `), 0) as revenue,
+			COUNT(DISTINCT o.order_id) as orders
+		` + from + `
+		JOIN payment_methods pm ON pm.payment_method_id = o.payment_method_id
+		` + whereClause(f, qa) + `
+		GROUP BY pm.name
+		ORDER BY revenue DESC
+		` + limitClause(f, qa) + `
+	`
 
-	switch interval {
-	case "monthly":
-		timeFormat = "YYYY-MM"
-		groupBy = "DATE_TRUNC('month', o.sale_date)"
-	case "quarterly":
-		timeFormat = "YYYY-\"Q\"Q"
-		groupBy = "DATE_TRUNC('quarter', o.sale_date)"
-	case "yearly":
-		timeFormat = "YYYY"
-		groupBy = "DATE_TRUNC('year', o.sale_date)"
+	rows, err := as.db.QueryContext(ctx, query, qa.values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []map[string]interface{}
+
+	for rows.Next() {
+		var paymentMethod string
+		var revenue float64
+		var orders int
+
+		if err := rows.Scan(&paymentMethod, &revenue, &orders); err != nil {
+			return nil, err
+		}
+
+		results = append(results, map[string]interface{}{
+			"payment_method":      paymentMethod,
+			"revenue":             revenue,
+			"orders":              orders,
+			"average_order_value": revenue / float64(orders),
+		})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// customerGroupKey returns the customer ID expression to group customers c by
+// "master" rolls up customer IDs linked by identity resolution into their master customer
+func customerGroupKey(groupBy string) (string, error) {
+	switch groupBy {
+	case "customer", "":
+		return "c.customer_id", nil
+	case "master":
+		return "COALESCE(c.master_customer_id, c.customer_id)", nil
 	default:
-		return nil, errors.New("invalid interval: must be 'monthly', 'quarterly', or 'yearly'")
+		return "", errors.New("invalid group_by: must be 'customer' or 'master'")
+	}
+}
+
+// GetRevenueByCustomer calculates revenue for each customer matching the filter
+// groupBy "master" rolls up customer IDs linked by identity resolution into their master customer
+func (as *AnalyticsService) GetRevenueByCustomer(ctx context.Context, f models.Filter, groupBy string) ([]map[string]interface{}, error) {
+	customerKey, err := customerGroupKey(groupBy)
+	if err != nil {
+		return nil, err
+	}
+
+	from, err := revenueFrom(f.AsOf)
+	if err != nil {
+		return nil, err
+	}
+
+	revenueSQL, err := revenueMeasure(f.RevenueBasis)
+	if err != nil {
+		return nil, err
 	}
 
+	qa := &queryArgs{}
 	query := `
 		SELECT 
-			TO_CHAR(` + groupBy + `, '` + timeFormat + `') as time_period,
-			COALESCE(SUM((oi.unit_price * oi.quantity) * (1 - oi.discount)), 0) as revenue
-		FROM orders o
-		JOIN order_items oi ON o.order_id = oi.order_id
-		WHERE o.sale_date BETWEEN $1 AND $2
-		GROUP BY time_period
-		ORDER BY time_period
+			gc.customer_id,
+			gc.name,
+			COUNT(DISTINCT c.customer_id) as linked_customers,
+			COALESCE(SUM(` + revenueSQL + `), 0) as revenue
+		` + from + `
+		JOIN customers c ON o.customer_id = c.customer_id
+		JOIN customers gc ON gc.customer_id = ` + customerKey + `
+		` + whereClause(f, qa) + `
+		GROUP BY gc.customer_id, gc.name
+		ORDER BY revenue DESC
+		` + limitClause(f, qa) + `
 	`
 
-	rows, err := as.db.QueryContext(ctx, query, startDate, endDate)
+	rows, err := as.db.QueryContext(ctx, query, qa.values...)
 	if err != nil {
 		return nil, err
 	}
@@ -204,16 +381,19 @@ func (as *AnalyticsService) GetRevenueOverTime(ctx context.Context, startDate, e
 	var results []map[string]interface{}
 
 	for rows.Next() {
-		var timePeriod string
+		var customerID, name string
+		var linkedCustomers int
 		var revenue float64
 
-		if err := rows.Scan(&timePeriod, &revenue); err != nil {
+		if err := rows.Scan(&customerID, &name, &linkedCustomers, &revenue); err != nil {
 			return nil, err
 		}
 
 		results = append(results, map[string]interface{}{
-			"time_period": timePeriod,
-			"revenue":     revenue,
+			"customer_id":      customerID,
+			"name":             name,
+			"linked_customers": linkedCustomers,
+			"revenue":          revenue,
 		})
 	}
 
@@ -223,3 +403,102 @@ func (as *AnalyticsService) GetRevenueOverTime(ctx context.Context, startDate, e
 
 	return results, nil
 }
+
+// GetRevenueOverTime calculates revenue trends over time for sales matching the filter
+// Periods without sales are filled with zero revenue, so every period in the date range is returned.
+// Each period also has the cumulative revenue so far and, for each window in rollingWindows,
+// the average revenue over that many periods up to and including it (rolling_avg_<window>).
+func (as *AnalyticsService) GetRevenueOverTime(ctx context.Context, f models.Filter, interval string, rollingWindows []int) ([]map[string]interface{}, error) {
+	unit, timeFormat, err := timeBucket(interval)
+	if err != nil {
+		return nil, err
+	}
+
+	from, err := revenueFrom(f.AsOf)
+	if err != nil {
+		return nil, err
+	}
+
+	revenueSQL, err := revenueMeasure(f.RevenueBasis)
+	if err != nil {
+		return nil, err
+	}
+
+	var rollingColumns string
+	for _, window := range rollingWindows {
+		if window < 1 {
+			return nil, errors.New("invalid rolling window: must be at least 1 period")
+		}
+		size := strconv.Itoa(window)
+		rollingColumns += `,
+			AVG(COALESCE(rv.revenue, 0)) OVER (ORDER BY p.period ROWS BETWEEN ` + strconv.Itoa(window-1) + ` PRECEDING AND CURRENT ROW) as rolling_avg_` + size
+	}
+
+	qa := &queryArgs{}
+	where := whereClause(f, qa)
+
+	query := `
+		WITH revenue AS (
+			SELECT
+				DATE_TRUNC('` + unit + `', o.sale_date) as period,
+				SUM(` + revenueSQL + `) as revenue
+			` + from + `
+			` + where + `
+			GROUP BY 1
+		),
+		periods AS (
+			SELECT GENERATE_SERIES(
+				DATE_TRUNC('` + unit + `', ` + qa.add(f.StartDate) + `::date),
+				DATE_TRUNC('` + unit + `', ` + qa.add(f.EndDate) + `::date),
+				'` + bucketStep(unit) + `'::interval
+			) as period
+		)
+		SELECT 
+			TO_CHAR(p.period, '` + timeFormat + `') as time_period,
+			COALESCE(rv.revenue, 0) as revenue,
+			SUM(COALESCE(rv.revenue, 0)) OVER (ORDER BY p.period) as cumulative_revenue` + rollingColumns + `
+		FROM periods p
+		LEFT JOIN revenue rv ON rv.period = p.period
+		ORDER BY p.period
+	`
+
+	rows, err := as.db.QueryContext(ctx, query, qa.values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []map[string]interface{}
+
+	for rows.Next() {
+		var timePeriod string
+		var revenue, cumulativeRevenue float64
+		rollingAverages := make([]float64, len(rollingWindows))
+
+		dest := []interface{}{&timePeriod, &revenue, &cumulativeRevenue}
+		for i := range rollingAverages {
+			dest = append(dest, &rollingAverages[i])
+		}
+
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		row := map[string]interface{}{
+			"time_period":        timePeriod,
+			"revenue":            revenue,
+			"cumulative_revenue": cumulativeRevenue,
+		}
+		for i, window := range rollingWindows {
+			row["rolling_avg_"+strconv.Itoa(window)] = rollingAverages[i]
+		}
+
+		results = append(results, row)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
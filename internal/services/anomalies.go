@@ -0,0 +1,280 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Dimensions daily revenue is checked along, with the column each one groups by
+var anomalyDimensions = map[string]string{
+	"region":   "r.name",
+	"category": "p.category",
+}
+
+// Fewest previous same-weekday values needed before a day can be flagged
+const minAnomalyHistory = 4
+
+// The standard deviation a day is scored against is at least this share of the expected revenue,
+// so a nearly flat history (a few cents of variation) can't turn an ordinary change into a huge z-score
+const minAnomalyRelativeStddev = 0.01
+
+// RevenueAnomaly is a day where revenue for a region or category strayed too far from its usual level
+type RevenueAnomaly struct {
+	Dimension      string    `json:"dimension"`
+	DimensionValue string    `json:"dimension_value"`
+	SaleDate       time.Time `json:"sale_date"`
+	Revenue        float64   `json:"revenue"`
+	Expected       float64   `json:"expected"`
+	ZScore         float64   `json:"z_score"`
+	Direction      string    `json:"direction"`
+}
+
+// findRevenueAnomalies scores daily revenue for every value of a dimension with a seasonal z-score:
+// each day is compared with the same weekday over the previous weeks, see anomalyZScore. Days without sales count as zero
+// from the first sale of each value onwards, so a region or category missing from an export shows up as a drop.
+func (as *AnalyticsService) findRevenueAnomalies(ctx context.Context, dimension string, weeks int, threshold float64) ([]RevenueAnomaly, error) {
+	column := anomalyDimensions[dimension]
+
+	rows, err := as.db.QueryContext(ctx, `
+		WITH daily AS (
+			SELECT `+column+` as value, o.sale_date as day, SUM(`+revenueExpr+`) as revenue
+			FROM order_items oi
+			JOIN orders o ON oi.order_id = o.order_id
+			JOIN products p ON oi.product_id = p.product_id
+			JOIN regions r ON o.region_id = r.region_id
+			GROUP BY 1, 2
+		),
+		days AS (
+			SELECT GENERATE_SERIES(MIN(day), MAX(day), INTERVAL '1 day')::date as day FROM daily
+		),
+		series AS (
+			SELECT v.value, d.day, COALESCE(dl.revenue, 0) as revenue
+			FROM (SELECT value, MIN(day) as first_day FROM daily GROUP BY value) v
+			JOIN days d ON d.day >= v.first_day
+			LEFT JOIN daily dl ON dl.value = v.value AND dl.day = d.day
+		),
+		baseline AS (
+			SELECT
+				value,
+				day,
+				revenue,
+				AVG(revenue) OVER w as expected,
+				STDDEV_SAMP(revenue) OVER w as stddev,
+				COUNT(*) OVER w as history
+			FROM series
+			WINDOW w AS (PARTITION BY value, EXTRACT(ISODOW FROM day) ORDER BY day ROWS BETWEEN $1 PRECEDING AND 1 PRECEDING)
+		)
+		SELECT value, day, revenue, expected, COALESCE(stddev, 0)
+		FROM baseline
+		WHERE history >= $2 AND GREATEST(COALESCE(stddev, 0), $3 * ABS(expected)) > 0
+		ORDER BY day, value
+	`, weeks, minAnomalyHistory, minAnomalyRelativeStddev)
+	if err != nil {
+		return nil, fmt.Errorf("failed to score daily %s revenue: %w", dimension, err)
+	}
+	defer rows.Close()
+
+	var anomalies []RevenueAnomaly
+	for rows.Next() {
+		anomaly := RevenueAnomaly{Dimension: dimension, Direction: "spike"}
+		var stddev float64
+		if err := rows.Scan(&anomaly.DimensionValue, &anomaly.SaleDate, &anomaly.Revenue, &anomaly.Expected, &stddev); err != nil {
+			return nil, err
+		}
+
+		var anomalous bool
+		anomaly.ZScore, anomalous = anomalyZScore(anomaly.Revenue, anomaly.Expected, stddev, threshold)
+		if !anomalous {
+			continue
+		}
+		if anomaly.ZScore < 0 {
+			anomaly.Direction = "drop"
+		}
+		anomalies = append(anomalies, anomaly)
+	}
+
+	return anomalies, rows.Err()
+}
+
+// anomalyZScore scores a day against its same-weekday baseline and reports whether it is an anomaly.
+// The standard deviation is floored at minAnomalyRelativeStddev of the expected revenue, so a day
+// that drops to zero after a perfectly flat history is still flagged. A baseline of zero can't be scored.
+func anomalyZScore(revenue, expected, stddev, threshold float64) (float64, bool) {
+	stddev = math.Max(stddev, minAnomalyRelativeStddev*math.Abs(expected))
+	if stddev == 0 {
+		return 0, false
+	}
+
+	z := (revenue - expected) / stddev
+	return z, math.Abs(z) >= threshold
+}
+
+// DetectRevenueAnomalies rescans daily revenue by region and category after a refresh and replaces
+// revenue_anomalies. Anomalies on sale dates loaded by the refresh are also recorded on its log entry,
+// since a sudden drop there usually means a broken export rather than a real change in sales.
+func (as *AnalyticsService) DetectRevenueAnomalies(ctx context.Context, logID int, weeks int, threshold float64) error {
+	if weeks < minAnomalyHistory {
+		return fmt.Errorf("anomaly weeks must be at least %d, got %d", minAnomalyHistory, weeks)
+	}
+	if threshold <= 0 {
+		return fmt.Errorf("anomaly threshold must be positive, got %v", threshold)
+	}
+
+	var anomalies []RevenueAnomaly
+	for _, dimension := range []string{"region", "category"} {
+		found, err := as.findRevenueAnomalies(ctx, dimension, weeks, threshold)
+		if err != nil {
+			return err
+		}
+		anomalies = append(anomalies, found...)
+	}
+
+	loadedDates, err := as.loadedSaleDates(ctx, logID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := as.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM revenue_anomalies`); err != nil {
+		return fmt.Errorf("failed to clear revenue anomalies: %w", err)
+	}
+
+	insertStmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO revenue_anomalies
+			(dimension, dimension_value, sale_date, revenue, expected, z_score, direction, log_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare revenue anomaly statement: %w", err)
+	}
+	defer insertStmt.Close()
+
+	inLoad := []RevenueAnomaly{}
+	for _, anomaly := range anomalies {
+		_, err := insertStmt.ExecContext(
+			ctx,
+			anomaly.Dimension,
+			anomaly.DimensionValue,
+			anomaly.SaleDate,
+			anomaly.Revenue,
+			anomaly.Expected,
+			anomaly.ZScore,
+			anomaly.Direction,
+			logID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert revenue anomaly: %w", err)
+		}
+
+		if loadedDates[anomaly.SaleDate.Format("2006-01-02")] {
+			inLoad = append(inLoad, anomaly)
+		}
+	}
+
+	report, err := json.Marshal(inLoad)
+	if err != nil {
+		return fmt.Errorf("failed to marshal anomaly report: %w", err)
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`UPDATE data_refresh_logs SET anomaly_count = $1, anomalies = $2 WHERE log_id = $3`,
+		len(inLoad),
+		string(report),
+		logID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store anomalies on refresh log: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// loadedSaleDates returns the sale dates of the orders written by a refresh
+func (as *AnalyticsService) loadedSaleDates(ctx context.Context, logID int) (map[string]bool, error) {
+	rows, err := as.db.QueryContext(ctx, `SELECT DISTINCT sale_date FROM orders WHERE log_id = $1`, logID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get loaded sale dates: %w", err)
+	}
+	defer rows.Close()
+
+	dates := make(map[string]bool)
+	for rows.Next() {
+		var saleDate time.Time
+		if err := rows.Scan(&saleDate); err != nil {
+			return nil, err
+		}
+		dates[saleDate.Format("2006-01-02")] = true
+	}
+
+	return dates, rows.Err()
+}
+
+// GetRevenueAnomalies returns the anomalies found by the last scan with a sale date in the range,
+// optionally only for one dimension ("region" or "category") or direction ("drop" or "spike")
+func (as *AnalyticsService) GetRevenueAnomalies(ctx context.Context, startDate, endDate, dimension, direction string, limit int) ([]map[string]interface{}, error) {
+	qa := &queryArgs{}
+	where := "WHERE sale_date BETWEEN " + qa.add(startDate) + " AND " + qa.add(endDate)
+
+	if dimension != "" {
+		where += " AND dimension = " + qa.add(dimension)
+	}
+	if direction != "" {
+		where += " AND direction = " + qa.add(direction)
+	}
+
+	limitSQL := ""
+	if limit > 0 {
+		limitSQL = "LIMIT " + qa.add(limit)
+	}
+
+	rows, err := as.db.QueryContext(ctx, `
+		SELECT dimension, dimension_value, sale_date, revenue, expected, z_score, direction, log_id, detected_at
+		FROM revenue_anomalies
+		`+where+`
+		ORDER BY sale_date DESC, ABS(z_score) DESC
+		`+limitSQL, qa.values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []map[string]interface{}
+
+	for rows.Next() {
+		var dim, value, dir string
+		var saleDate, detectedAt time.Time
+		var revenue, expected, zScore float64
+		var logID *int
+
+		if err := rows.Scan(&dim, &value, &saleDate, &revenue, &expected, &zScore, &dir, &logID, &detectedAt); err != nil {
+			return nil, err
+		}
+
+		results = append(results, map[string]interface{}{
+			"dimension":       dim,
+			"dimension_value": value,
+			"sale_date":       saleDate.Format("2006-01-02"),
+			"revenue":         revenue,
+			"expected":        expected,
+			"z_score":         zScore,
+			"direction":       dir,
+			"log_id":          logID,
+			"detected_at":     detectedAt,
+		})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
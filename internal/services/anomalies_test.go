@@ -0,0 +1,32 @@
+package services
+
+import "testing"
+
+func TestAnomalyZScore(t *testing.T) {
+	tests := []struct {
+		name              string
+		revenue, expected float64
+		stddev            float64
+		wantZ             float64
+		want              bool
+	}{
+		// Four identical weeks have a sample standard deviation of zero, the floor still scores the drop
+		{"zero day after a flat history", 0, 100, 0, -100, true},
+		{"same as a flat history", 100, 100, 0, 0, false},
+		{"small change on a flat history", 102, 100, 0, 2, false},
+		{"nearly flat history", 90, 100, 0.05, -10, true},
+		{"spike", 160, 100, 20, 3, true},
+		{"within the threshold", 130, 100, 20, 1.5, false},
+		{"drop on the threshold", 40, 100, 20, -3, true},
+		{"empty history", 50, 0, 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			z, anomalous := anomalyZScore(tt.revenue, tt.expected, tt.stddev, 3)
+			if !almostEqual(z, tt.wantZ) || anomalous != tt.want {
+				t.Errorf("anomalyZScore = %v, %v, want %v, %v", z, anomalous, tt.wantZ, tt.want)
+			}
+		})
+	}
+}
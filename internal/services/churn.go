@@ -0,0 +1,268 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Churn risk levels by churn probability
+const (
+	ChurnRiskLow    = "low"
+	ChurnRiskMedium = "medium"
+	ChurnRiskHigh   = "high"
+)
+
+// ChurnRisks lists every risk level a customer can be placed in
+var ChurnRisks = []string{ChurnRiskLow, ChurnRiskMedium, ChurnRiskHigh}
+
+// Churn probabilities at which a customer becomes medium and high risk
+const (
+	churnMediumThreshold = 0.5
+	churnHighThreshold   = 0.8
+)
+
+// churnRisk names the risk level of a churn probability
+func churnRisk(probability float64) string {
+	switch {
+	case probability >= churnHighThreshold:
+		return ChurnRiskHigh
+	case probability >= churnMediumThreshold:
+		return ChurnRiskMedium
+	default:
+		return ChurnRiskLow
+	}
+}
+
+// churnProbability treats the time between purchases as exponential with the customer's mean interval,
+// so the chance they would have bought again by now if still active is 1 - exp(-recency / interval).
+// A customer silent for one interval is at 63%, for two at 86%.
+func churnProbability(recencyDays, avgIntervalDays float64) float64 {
+	if avgIntervalDays <= 0 {
+		return 0
+	}
+	return 1 - math.Exp(-recencyDays/avgIntervalDays)
+}
+
+// RefreshChurnScores recomputes churn scores for every customer from their purchase intervals and replaces
+// customer_churn_scores. Recency is measured from the latest sale in the data, like the RFM scores.
+// One time buyers have no interval of their own and are scored with the median interval of repeat customers.
+// Without any repeat customers nobody can be scored, the table is left empty rather than keeping old scores.
+// Linked customer IDs are scored as their master customer.
+func (as *AnalyticsService) RefreshChurnScores(ctx context.Context, logID int) error {
+	rows, err := as.db.QueryContext(ctx, `
+		SELECT
+			COALESCE(c.master_customer_id, c.customer_id) as customer_id,
+			COUNT(DISTINCT o.order_id) as orders,
+			COALESCE(SUM(`+revenueExpr+`), 0) as revenue,
+			MAX(o.sale_date) as last_purchase,
+			(SELECT MAX(sale_date) FROM orders) - MAX(o.sale_date) as recency_days,
+			CASE WHEN COUNT(DISTINCT o.sale_date) > 1
+				THEN (MAX(o.sale_date) - MIN(o.sale_date))::float / (COUNT(DISTINCT o.sale_date) - 1)
+			END as avg_interval_days
+		FROM order_items oi
+		JOIN orders o ON oi.order_id = o.order_id
+		JOIN customers c ON o.customer_id = c.customer_id
+		GROUP BY COALESCE(c.master_customer_id, c.customer_id)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to compute purchase intervals: %w", err)
+	}
+	defer rows.Close()
+
+	type churnScore struct {
+		customerID   string
+		orders       int
+		revenue      float64
+		lastPurchase time.Time
+		recencyDays  int
+		avgInterval  *float64
+	}
+
+	var scores []churnScore
+	var intervals []float64
+	for rows.Next() {
+		var score churnScore
+		if err := rows.Scan(&score.customerID, &score.orders, &score.revenue, &score.lastPurchase, &score.recencyDays, &score.avgInterval); err != nil {
+			return err
+		}
+		if score.avgInterval != nil {
+			intervals = append(intervals, *score.avgInterval)
+		}
+		scores = append(scores, score)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	tx, err := as.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM customer_churn_scores`); err != nil {
+		return fmt.Errorf("failed to clear churn scores: %w", err)
+	}
+
+	// Without any repeat customers there is nothing to tell how often people come back
+	if len(intervals) == 0 {
+		return tx.Commit()
+	}
+	sort.Float64s(intervals)
+	typicalInterval := intervals[len(intervals)/2]
+	if len(intervals)%2 == 0 {
+		typicalInterval = (intervals[len(intervals)/2-1] + typicalInterval) / 2
+	}
+
+	insertStmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO customer_churn_scores
+			(customer_id, orders, revenue, last_purchase, recency_days, avg_interval_days,
+			 churn_probability, risk, expected_next_purchase, log_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare churn score statement: %w", err)
+	}
+	defer insertStmt.Close()
+
+	for _, score := range scores {
+		interval := typicalInterval
+		if score.avgInterval != nil {
+			interval = *score.avgInterval
+		}
+
+		probability := churnProbability(float64(score.recencyDays), interval)
+		expectedNext := score.lastPurchase.AddDate(0, 0, int(math.Round(interval)))
+
+		_, err := insertStmt.ExecContext(
+			ctx,
+			score.customerID,
+			score.orders,
+			score.revenue,
+			score.lastPurchase,
+			score.recencyDays,
+			interval,
+			probability,
+			churnRisk(probability),
+			expectedNext,
+			logID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert churn score: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetChurnScores returns the stored churn scores, optionally only for the given risk levels,
+// most likely to churn first and then by revenue so valuable customers come before small ones.
+// The summary has the number of customers and revenue at each risk level.
+func (as *AnalyticsService) GetChurnScores(ctx context.Context, risks []string, limit int) ([]map[string]interface{}, []map[string]interface{}, error) {
+	qa := &queryArgs{}
+	where := ""
+	if len(risks) > 0 {
+		where = "WHERE s.risk = ANY(" + qa.add(pq.Array(risks)) + ")"
+	}
+
+	limitSQL := ""
+	if limit > 0 {
+		limitSQL = "LIMIT " + qa.add(limit)
+	}
+
+	rows, err := as.db.QueryContext(ctx, `
+		SELECT
+			s.customer_id,
+			c.name,
+			c.email,
+			s.orders,
+			s.revenue,
+			s.last_purchase,
+			s.recency_days,
+			s.avg_interval_days,
+			s.churn_probability,
+			s.risk,
+			s.expected_next_purchase,
+			s.computed_at
+		FROM customer_churn_scores s
+		JOIN customers c ON c.customer_id = s.customer_id
+		`+where+`
+		ORDER BY s.churn_probability DESC, s.revenue DESC
+		`+limitSQL, qa.values...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var customers []map[string]interface{}
+
+	for rows.Next() {
+		var customerID, name, email, risk string
+		var orders, recencyDays int
+		var revenue, avgInterval, probability float64
+		var lastPurchase, expectedNext, computedAt time.Time
+
+		if err := rows.Scan(&customerID, &name, &email, &orders, &revenue, &lastPurchase, &recencyDays, &avgInterval, &probability, &risk, &expectedNext, &computedAt); err != nil {
+			return nil, nil, err
+		}
+
+		customers = append(customers, map[string]interface{}{
+			"customer_id":            customerID,
+			"name":                   name,
+			"email":                  email,
+			"orders":                 orders,
+			"revenue":                revenue,
+			"last_purchase":          lastPurchase.Format("2006-01-02"),
+			"recency_days":           recencyDays,
+			"avg_interval_days":      avgInterval,
+			"churn_probability":      probability,
+			"risk":                   risk,
+			"expected_next_purchase": expectedNext.Format("2006-01-02"),
+			"computed_at":            computedAt,
+		})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	summaryRows, err := as.db.QueryContext(ctx, `
+		SELECT risk, COUNT(*), COALESCE(SUM(revenue), 0)
+		FROM customer_churn_scores
+		GROUP BY risk
+		ORDER BY MIN(churn_probability) DESC
+	`)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer summaryRows.Close()
+
+	var summary []map[string]interface{}
+
+	for summaryRows.Next() {
+		var risk string
+		var customerCount int
+		var revenue float64
+
+		if err := summaryRows.Scan(&risk, &customerCount, &revenue); err != nil {
+			return nil, nil, err
+		}
+
+		summary = append(summary, map[string]interface{}{
+			"risk":      risk,
+			"customers": customerCount,
+			"revenue":   revenue,
+		})
+	}
+
+	if err = summaryRows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return customers, summary, nil
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/prajwalbharadwajbm/backend_assessment/internal/models"
+)
+
+// periodOffset counts the whole periods of the DATE_TRUNC unit between two truncated dates
+func periodOffset(unit string, from, to time.Time) int {
+	months := (to.Year()-from.Year())*12 + int(to.Month()-from.Month())
+
+	switch unit {
+	case "day":
+		return int(math.Round(to.Sub(from).Hours() / 24))
+	case "week":
+		return int(math.Round(to.Sub(from).Hours() / (24 * 7)))
+	case "quarter":
+		return months / 3
+	case "year":
+		return to.Year() - from.Year()
+	default:
+		return months
+	}
+}
+
+// GetCohortRetention groups customers into acquisition cohorts by the period of their first purchase
+// (across all history, linked customer IDs count as their master customer) and returns, for every cohort,
+// how many customers came back and how much they spent in each following period.
+// The filter restricts the cohorts to those acquired in its date range and the activity to matching sales.
+func (as *AnalyticsService) GetCohortRetention(ctx context.Context, f models.Filter, interval string) ([]map[string]interface{}, error) {
+	unit, timeFormat, err := timeBucket(interval)
+	if err != nil {
+		return nil, err
+	}
+
+	from, err := revenueFrom(f.AsOf)
+	if err != nil {
+		return nil, err
+	}
+
+	revenueSQL, err := revenueMeasure(f.RevenueBasis)
+	if err != nil {
+		return nil, err
+	}
+
+	qa := &queryArgs{}
+	where := whereClause(f, qa)
+
+	query := `
+		WITH first_purchases AS (
+			SELECT
+				COALESCE(c.master_customer_id, c.customer_id) as customer_id,
+				DATE_TRUNC('` + unit + `', MIN(o.sale_date)) as cohort
+			FROM orders o
+			JOIN customers c ON o.customer_id = c.customer_id
+			GROUP BY COALESCE(c.master_customer_id, c.customer_id)
+		),
+		cohorts AS (
+			SELECT cohort, COUNT(*) as cohort_size
+			FROM first_purchases
+			WHERE cohort BETWEEN DATE_TRUNC('` + unit + `', ` + qa.add(f.StartDate) + `::date) AND ` + qa.add(f.EndDate) + `::date
+			GROUP BY cohort
+		),
+		activity AS (
+			SELECT
+				COALESCE(c.master_customer_id, c.customer_id) as customer_id,
+				DATE_TRUNC('` + unit + `', o.sale_date) as period,
+				SUM(` + revenueSQL + `) as revenue
+			` + from + `
+			JOIN customers c ON o.customer_id = c.customer_id
+			` + where + `
+			GROUP BY 1, 2
+		)
+		SELECT
+			ch.cohort,
+			TO_CHAR(ch.cohort, '` + timeFormat + `') as cohort_period,
+			ch.cohort_size,
+			a.period,
+			TO_CHAR(a.period, '` + timeFormat + `') as time_period,
+			COUNT(DISTINCT a.customer_id) as active_customers,
+			COALESCE(SUM(a.revenue), 0) as revenue
+		FROM cohorts ch
+		JOIN first_purchases fp ON fp.cohort = ch.cohort
+		JOIN activity a ON a.customer_id = fp.customer_id AND a.period >= ch.cohort
+		GROUP BY ch.cohort, ch.cohort_size, a.period
+		ORDER BY ch.cohort, a.period
+	`
+
+	rows, err := as.db.QueryContext(ctx, query, qa.values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []map[string]interface{}
+	var current map[string]interface{}
+	var currentCohort time.Time
+
+	for rows.Next() {
+		var cohort, period time.Time
+		var cohortPeriod, timePeriod string
+		var cohortSize, activeCustomers int
+		var revenue float64
+
+		if err := rows.Scan(&cohort, &cohortPeriod, &cohortSize, &period, &timePeriod, &activeCustomers, &revenue); err != nil {
+			return nil, err
+		}
+
+		// Rows come ordered by cohort, start a new matrix row whenever the cohort changes
+		if current == nil || !cohort.Equal(currentCohort) {
+			current = map[string]interface{}{
+				"cohort":    cohortPeriod,
+				"customers": cohortSize,
+				"periods":   []map[string]interface{}{},
+			}
+			currentCohort = cohort
+			results = append(results, current)
+		}
+
+		current["periods"] = append(current["periods"].([]map[string]interface{}), map[string]interface{}{
+			"period":           periodOffset(unit, cohort, period),
+			"time_period":      timePeriod,
+			"active_customers": activeCustomers,
+			"retention":        float64(activeCustomers) / float64(cohortSize),
+			"revenue":          revenue,
+		})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
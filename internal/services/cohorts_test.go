@@ -0,0 +1,31 @@
+package services
+
+import "testing"
+
+func TestPeriodOffset(t *testing.T) {
+	tests := []struct {
+		unit     string
+		from, to string
+		want     int
+	}{
+		{"day", "2024-03-01", "2024-03-01", 0},
+		{"day", "2024-02-28", "2024-03-01", 2}, // leap year
+		{"day", "2023-12-31", "2024-01-01", 1},
+		{"week", "2024-01-01", "2024-01-01", 0},
+		{"week", "2020-12-28", "2021-01-04", 1}, // ISO week 53 into week 1
+		{"week", "2023-12-25", "2024-03-04", 10},
+		{"month", "2024-01-01", "2024-01-01", 0},
+		{"month", "2023-11-01", "2024-02-01", 3},
+		{"month", "2022-12-01", "2024-12-01", 24},
+		{"quarter", "2023-10-01", "2024-01-01", 1},
+		{"quarter", "2023-04-01", "2024-10-01", 6},
+		{"year", "2023-01-01", "2024-01-01", 1},
+		{"year", "2020-01-01", "2024-01-01", 4},
+	}
+
+	for _, tt := range tests {
+		if got := periodOffset(tt.unit, date(tt.from), date(tt.to)); got != tt.want {
+			t.Errorf("periodOffset(%q, %s, %s) = %d, want %d", tt.unit, tt.from, tt.to, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prajwalbharadwajbm/backend_assessment/internal/models"
+)
+
+// Comparison modes for period-over-period results
+const (
+	// ComparePreviousPeriod compares with the period of the same length right before the current one
+	ComparePreviousPeriod = "previous_period"
+	// ComparePreviousYear compares with the same dates one year earlier
+	ComparePreviousYear = "previous_year"
+	// CompareCustom compares with an explicit date range
+	CompareCustom = "custom"
+)
+
+// ComparisonFilter returns a copy of the filter moved to the comparison period.
+// compareStart and compareEnd are only used by CompareCustom.
+// The comparison has no limit, so rows that dropped out of the current results can still be matched.
+func ComparisonFilter(f models.Filter, mode, compareStart, compareEnd string) (models.Filter, error) {
+	comparison := f
+	comparison.Limit = 0
+
+	start, err := time.Parse("2006-01-02", f.StartDate)
+	if err != nil {
+		return comparison, fmt.Errorf("invalid start_date: %w", err)
+	}
+	end, err := time.Parse("2006-01-02", f.EndDate)
+	if err != nil {
+		return comparison, fmt.Errorf("invalid end_date: %w", err)
+	}
+
+	switch mode {
+	case ComparePreviousPeriod:
+		days := int(end.Sub(start).Hours()/24) + 1
+		comparison.EndDate = start.AddDate(0, 0, -1).Format("2006-01-02")
+		comparison.StartDate = start.AddDate(0, 0, -days).Format("2006-01-02")
+	case ComparePreviousYear:
+		comparison.StartDate = start.AddDate(-1, 0, 0).Format("2006-01-02")
+		comparison.EndDate = end.AddDate(-1, 0, 0).Format("2006-01-02")
+	case CompareCustom:
+		if _, err := time.Parse("2006-01-02", compareStart); err != nil {
+			return comparison, fmt.Errorf("invalid compare_start_date: %w", err)
+		}
+		if _, err := time.Parse("2006-01-02", compareEnd); err != nil {
+			return comparison, fmt.Errorf("invalid compare_end_date: %w", err)
+		}
+		comparison.StartDate = compareStart
+		comparison.EndDate = compareEnd
+	default:
+		return comparison, errors.New("invalid compare: must be 'previous_period', 'previous_year' or 'custom'")
+	}
+
+	return comparison, nil
+}
+
+// CompareValues returns the current and comparison values with their absolute and percentage change
+// The percentage change is nil when the comparison value is zero
+func CompareValues(current, comparison float64) map[string]interface{} {
+	var changePct *float64
+	if comparison != 0 {
+		pct := (current - comparison) / comparison * 100
+		changePct = &pct
+	}
+
+	return map[string]interface{}{
+		"current":    current,
+		"comparison": comparison,
+		"change":     current - comparison,
+		"change_pct": changePct,
+	}
+}
+
+// CompareRows matches breakdown rows from the current and comparison periods on key and adds
+// comparison_revenue, change and change_pct to each current row. When includeDropped is set,
+// rows that only exist in the comparison period are appended with zero current revenue.
+func CompareRows(current, comparison []map[string]interface{}, key string, includeDropped bool) []map[string]interface{} {
+	previous := make(map[interface{}]map[string]interface{}, len(comparison))
+	for _, row := range comparison {
+		previous[row[key]] = row
+	}
+
+	results := make([]map[string]interface{}, 0, len(current))
+	matched := make(map[interface{}]bool, len(current))
+
+	for _, row := range current {
+		var comparisonRevenue float64
+		if prev, ok := previous[row[key]]; ok {
+			comparisonRevenue = prev["revenue"].(float64)
+		}
+		matched[row[key]] = true
+		results = append(results, withComparison(row, comparisonRevenue))
+	}
+
+	if includeDropped {
+		for _, row := range comparison {
+			if matched[row[key]] {
+				continue
+			}
+			// Nothing was sold in the current period, so every figure of a dropped row is zero
+			dropped := make(map[string]interface{}, len(row))
+			for k, v := range row {
+				switch v.(type) {
+				case int:
+					dropped[k] = 0
+				case float64:
+					dropped[k] = 0.0
+				default:
+					dropped[k] = v
+				}
+			}
+			results = append(results, withComparison(dropped, row["revenue"].(float64)))
+		}
+	}
+
+	return results
+}
+
+// withComparison adds the comparison figures to a row holding the current revenue
+func withComparison(row map[string]interface{}, comparisonRevenue float64) map[string]interface{} {
+	values := CompareValues(row["revenue"].(float64), comparisonRevenue)
+	row["comparison_revenue"] = values["comparison"]
+	row["change"] = values["change"]
+	row["change_pct"] = values["change_pct"]
+	return row
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/prajwalbharadwajbm/backend_assessment/internal/models"
+)
+
+func TestComparisonFilter(t *testing.T) {
+	tests := []struct {
+		name                     string
+		start, end               string
+		mode                     string
+		compareStart, compareEnd string
+		wantStart, wantEnd       string
+		wantErr                  bool
+	}{
+		{name: "previous period of a month", start: "2024-03-01", end: "2024-03-31", mode: ComparePreviousPeriod, wantStart: "2024-01-30", wantEnd: "2024-02-29"},
+		{name: "previous period of a day", start: "2024-01-01", end: "2024-01-01", mode: ComparePreviousPeriod, wantStart: "2023-12-31", wantEnd: "2023-12-31"},
+		{name: "previous year", start: "2024-01-01", end: "2024-06-30", mode: ComparePreviousYear, wantStart: "2023-01-01", wantEnd: "2023-06-30"},
+		{name: "custom", start: "2024-01-01", end: "2024-01-31", mode: CompareCustom, compareStart: "2022-05-01", compareEnd: "2022-05-31", wantStart: "2022-05-01", wantEnd: "2022-05-31"},
+		{name: "custom without dates", start: "2024-01-01", end: "2024-01-31", mode: CompareCustom, wantErr: true},
+		{name: "unknown mode", start: "2024-01-01", end: "2024-01-31", mode: "last_week", wantErr: true},
+		{name: "bad start date", start: "01/01/2024", end: "2024-01-31", mode: ComparePreviousYear, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := models.Filter{StartDate: tt.start, EndDate: tt.end, Limit: 10, Regions: []string{"Europe"}}
+
+			got, err := ComparisonFilter(f, tt.mode, tt.compareStart, tt.compareEnd)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ComparisonFilter succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ComparisonFilter: %v", err)
+			}
+
+			if got.StartDate != tt.wantStart || got.EndDate != tt.wantEnd {
+				t.Errorf("period = %s to %s, want %s to %s", got.StartDate, got.EndDate, tt.wantStart, tt.wantEnd)
+			}
+			if got.Limit != 0 {
+				t.Errorf("Limit = %d, want 0", got.Limit)
+			}
+			if len(got.Regions) != 1 || got.Regions[0] != "Europe" {
+				t.Errorf("Regions = %q, want the filter's regions kept", got.Regions)
+			}
+		})
+	}
+}
+
+func TestCompareValues(t *testing.T) {
+	got := CompareValues(150, 100)
+	if got["change"] != 50.0 || *got["change_pct"].(*float64) != 50 {
+		t.Errorf("CompareValues(150, 100) = %v, want change 50 and change_pct 50", got)
+	}
+
+	if got := CompareValues(10, 0); got["change_pct"].(*float64) != nil {
+		t.Errorf("CompareValues(10, 0) change_pct = %v, want nil", *got["change_pct"].(*float64))
+	}
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/prajwalbharadwajbm/backend_assessment/internal/models"
+)
+
+// Average days in a month, used to turn active days into months for purchase frequency
+const daysPerMonth = 30.44
+
+// customerRankings are the metrics customers can be ranked by
+var customerRankings = map[string]string{
+	"revenue":             "revenue DESC",
+	"orders":              "orders DESC, revenue DESC",
+	"average_order_value": "average_order_value DESC",
+}
+
+// GetTopCustomers ranks customers by revenue, orders or average order value for sales matching the filter
+func (as *AnalyticsService) GetTopCustomers(ctx context.Context, f models.Filter, rankBy, groupBy string) ([]map[string]interface{}, error) {
+	orderBy, ok := customerRankings[rankBy]
+	if !ok {
+		return nil, errors.New("invalid rank_by: must be 'revenue', 'orders' or 'average_order_value'")
+	}
+
+	return as.customerMetrics(ctx, f, groupBy, orderBy)
+}
+
+// GetCustomerLifetimeValue returns lifetime value, average order value, first and last purchase
+// and purchase frequency for each customer matching the filter, along with the averages across all returned customers
+func (as *AnalyticsService) GetCustomerLifetimeValue(ctx context.Context, f models.Filter, groupBy string) ([]map[string]interface{}, map[string]interface{}, error) {
+	customers, err := as.customerMetrics(ctx, f, groupBy, "revenue DESC")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var totalValue, totalOrderValue, totalFrequency float64
+	for _, customer := range customers {
+		totalValue += customer["lifetime_value"].(float64)
+		totalOrderValue += customer["average_order_value"].(float64)
+		totalFrequency += customer["purchase_frequency"].(float64)
+	}
+
+	summary := map[string]interface{}{
+		"customers":                  len(customers),
+		"average_lifetime_value":     0.0,
+		"average_order_value":        0.0,
+		"average_purchase_frequency": 0.0,
+	}
+	if n := float64(len(customers)); n > 0 {
+		summary["average_lifetime_value"] = totalValue / n
+		summary["average_order_value"] = totalOrderValue / n
+		summary["average_purchase_frequency"] = totalFrequency / n
+	}
+
+	return customers, summary, nil
+}
+
+// customerMetrics computes the per customer metrics shared by the customer endpoints.
+// The filter picks the customers and their orders, revenue and average order value in the window.
+// First and last purchase, active days, lifetime value and purchase frequency cover every order
+// the customer ever placed, so a long standing customer isn't cut down to the filter's date range.
+func (as *AnalyticsService) customerMetrics(ctx context.Context, f models.Filter, groupBy, orderBy string) ([]map[string]interface{}, error) {
+	customerKey, err := customerGroupKey(groupBy)
+	if err != nil {
+		return nil, err
+	}
+
+	from, err := revenueFrom(f.AsOf)
+	if err != nil {
+		return nil, err
+	}
+
+	revenueSQL, err := revenueMeasure(f.RevenueBasis)
+	if err != nil {
+		return nil, err
+	}
+
+	qa := &queryArgs{}
+	query := `
+		WITH lifetime AS (
+			SELECT
+				` + customerKey + ` as customer_id,
+				COUNT(DISTINCT o.order_id) as orders,
+				COALESCE(SUM(` + revenueSQL + `), 0) as value,
+				MIN(o.sale_date) as first_purchase,
+				MAX(o.sale_date) as last_purchase
+			FROM order_items oi
+			JOIN orders o ON oi.order_id = o.order_id
+			JOIN customers c ON o.customer_id = c.customer_id
+			GROUP BY 1
+		)
+		SELECT
+			gc.customer_id,
+			gc.name,
+			COUNT(DISTINCT o.order_id) as orders,
+			COALESCE(SUM(` + revenueSQL + `), 0) as revenue,
+			COALESCE(SUM(` + revenueSQL + `) / NULLIF(COUNT(DISTINCT o.order_id), 0), 0) as average_order_value,
+			lt.orders as lifetime_orders,
+			lt.value as lifetime_value,
+			lt.first_purchase,
+			lt.last_purchase
+		` + from + `
+		JOIN customers c ON o.customer_id = c.customer_id
+		JOIN customers gc ON gc.customer_id = ` + customerKey + `
+		JOIN lifetime lt ON lt.customer_id = gc.customer_id
+		` + whereClause(f, qa) + `
+		GROUP BY gc.customer_id, gc.name, lt.orders, lt.value, lt.first_purchase, lt.last_purchase
+		ORDER BY ` + orderBy + `
+		` + limitClause(f, qa) + `
+	`
+
+	rows, err := as.db.QueryContext(ctx, query, qa.values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []map[string]interface{}
+
+	for rows.Next() {
+		var customerID, name string
+		var orders, lifetimeOrders int
+		var revenue, averageOrderValue, lifetimeValue float64
+		var firstPurchase, lastPurchase time.Time
+
+		if err := rows.Scan(&customerID, &name, &orders, &revenue, &averageOrderValue, &lifetimeOrders, &lifetimeValue, &firstPurchase, &lastPurchase); err != nil {
+			return nil, err
+		}
+
+		activeDays := int(lastPurchase.Sub(firstPurchase).Hours() / 24)
+
+		// Customers with a single order have no gap between orders
+		var daysBetweenOrders *float64
+		if lifetimeOrders > 1 {
+			days := float64(activeDays) / float64(lifetimeOrders-1)
+			daysBetweenOrders = &days
+		}
+
+		// Orders per month over the time the customer has been active, at least one month
+		purchaseFrequency := float64(lifetimeOrders) / math.Max(float64(activeDays)/daysPerMonth, 1)
+		lifetimeOrderValue := lifetimeValue / float64(lifetimeOrders)
+
+		results = append(results, map[string]interface{}{
+			"customer_id":             customerID,
+			"name":                    name,
+			"orders":                  orders,
+			"revenue":                 revenue,
+			"average_order_value":     averageOrderValue,
+			"lifetime_orders":         lifetimeOrders,
+			"lifetime_value":          lifetimeValue,
+			"first_purchase":          firstPurchase.Format("2006-01-02"),
+			"last_purchase":           lastPurchase.Format("2006-01-02"),
+			"active_days":             activeDays,
+			"avg_days_between_orders": daysBetweenOrders,
+			"purchase_frequency":      purchaseFrequency,
+			"projected_annual_value":  lifetimeOrderValue * purchaseFrequency * 12,
+		})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
@@ -16,9 +16,19 @@ import (
 )
 
 type DataLoader struct {
-	db     *database.DB
-	config *config.Config
-	logger *log.Logger
+	db               *database.DB
+	config           *config.Config
+	logger           *log.Logger
+	postRefreshHooks []postRefreshHook
+}
+
+// PostRefreshFunc is run after every successful refresh with the refresh log ID,
+// used to recompute derived data such as customer segments
+type PostRefreshFunc func(ctx context.Context, logID int) error
+
+type postRefreshHook struct {
+	name string
+	run  PostRefreshFunc
 }
 
 func NewDataLoader(db *database.DB, cfg *config.Config, logger *log.Logger) *DataLoader {
@@ -29,18 +39,25 @@ func NewDataLoader(db *database.DB, cfg *config.Config, logger *log.Logger) *Dat
 	}
 }
 
+// OnRefreshCompleted registers a step to run after every successful refresh, in registration order
+func (dl *DataLoader) OnRefreshCompleted(name string, fn PostRefreshFunc) {
+	dl.postRefreshHooks = append(dl.postRefreshHooks, postRefreshHook{name: name, run: fn})
+}
+
 // StartDataRefresh begins a data refresh process and logs it
 // triggeredBy is the source of the refresh, can be API or scheduled refresh
-func (dl *DataLoader) StartDataRefresh(ctx context.Context, triggeredBy string) (int, error) {
+// loadMode is recorded on the log so replaced data can be traced back to the refresh that did it
+func (dl *DataLoader) StartDataRefresh(ctx context.Context, triggeredBy, loadMode string) (int, error) {
 	// Start a refresh log
 	var logID int
 	err := dl.db.QueryRowContext(
 		ctx,
-		`INSERT INTO data_refresh_logs (start_time, status, triggered_by) 
-         VALUES ($1, $2, $3) RETURNING log_id`,
+		`INSERT INTO data_refresh_logs (start_time, status, triggered_by, load_mode) 
+         VALUES ($1, $2, $3, $4) RETURNING log_id`,
 		time.Now(),
 		"STARTED",
 		triggeredBy,
+		loadMode,
 	).Scan(&logID)
 
 	if err != nil {
@@ -80,8 +97,14 @@ func (dl *DataLoader) CompleteDataRefresh(ctx context.Context, logID int, rowsPr
 	return nil
 }
 
-func (dl *DataLoader) RefreshData(ctx context.Context, filePath string, triggeredBy string) error {
-	logID, err := dl.StartDataRefresh(ctx, triggeredBy)
+// RefreshData loads the CSV file in a single transaction using the given load mode (see LoadModeUpsert and friends)
+func (dl *DataLoader) RefreshData(ctx context.Context, filePath, triggeredBy, loadMode string) error {
+	loadMode, err := ValidateLoadMode(loadMode)
+	if err != nil {
+		return err
+	}
+
+	logID, err := dl.StartDataRefresh(ctx, triggeredBy, loadMode)
 	if err != nil {
 		return err
 	}
@@ -95,6 +118,13 @@ func (dl *DataLoader) RefreshData(ctx context.Context, filePath string, triggere
 	}
 	defer file.Close()
 
+	// Checksum the file up front so every loaded row can be traced back to this exact file
+	checksum, err := fileChecksum(file)
+	if err != nil {
+		dl.CompleteDataRefresh(ctx, logID, rowsProcessed, err)
+		return fmt.Errorf("failed to checksum CSV file: %w", err)
+	}
+
 	reader := csv.NewReader(file)
 
 	header, err := reader.Read()
@@ -114,11 +144,27 @@ func (dl *DataLoader) RefreshData(ctx context.Context, filePath string, triggere
 		return fmt.Errorf("failed to start transaction: %w", err)
 	}
 
+	sourceID, err := dl.registerDataSource(ctx, tx, logID, filePath, checksum)
+	if err != nil {
+		tx.Rollback()
+		dl.CompleteDataRefresh(ctx, logID, rowsProcessed, err)
+		return err
+	}
+
+	if err := dl.clearForLoad(ctx, tx, loadMode, file); err != nil {
+		tx.Rollback()
+		dl.CompleteDataRefresh(ctx, logID, rowsProcessed, err)
+		return err
+	}
+
 	insertCustomerStmt, err := tx.PrepareContext(ctx, `
-		INSERT INTO customers (customer_id, name, email, address)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO customers (customer_id, name, email, address, name_address_key, city)
+		VALUES ($1, $2, $3, $4, $5, $6)
 		ON CONFLICT (customer_id) DO UPDATE
-		SET name = $2, email = $3, address = $4
+		SET name = $2, email = $3, address = $4, name_address_key = $5, city = $6
+		WHERE NOT EXISTS (
+			SELECT 1 FROM customer_observations co WHERE co.customer_id = $1 AND co.sale_date > $7
+		)
 	`)
 	if err != nil {
 		tx.Rollback()
@@ -132,6 +178,9 @@ func (dl *DataLoader) RefreshData(ctx context.Context, filePath string, triggere
 		VALUES ($1, $2, $3)
 		ON CONFLICT (product_id) DO UPDATE
 		SET name = $2, category = $3
+		WHERE NOT EXISTS (
+			SELECT 1 FROM product_observations po WHERE po.product_id = $1 AND po.sale_date > $4
+		)
 	`)
 	if err != nil {
 		tx.Rollback()
@@ -164,11 +213,7 @@ func (dl *DataLoader) RefreshData(ctx context.Context, filePath string, triggere
 	}
 	defer insertPaymentMethodStmt.Close()
 
-	insertOrderStmt, err := tx.PrepareContext(ctx, `
-		INSERT INTO orders (order_id, customer_id, region_id, sale_date, shipping_cost, payment_method_id)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		ON CONFLICT (order_id) DO NOTHING
-	`)
+	insertOrderStmt, err := tx.PrepareContext(ctx, orderInsertSQL(loadMode))
 	if err != nil {
 		tx.Rollback()
 		dl.CompleteDataRefresh(ctx, logID, rowsProcessed, err)
@@ -176,11 +221,7 @@ func (dl *DataLoader) RefreshData(ctx context.Context, filePath string, triggere
 	}
 	defer insertOrderStmt.Close()
 
-	insertOrderItemStmt, err := tx.PrepareContext(ctx, `
-		INSERT INTO order_items (order_id, product_id, quantity, unit_price, discount)
-		VALUES ($1, $2, $3, $4, $5)
-		ON CONFLICT DO NOTHING
-	`)
+	insertOrderItemStmt, err := tx.PrepareContext(ctx, orderItemInsertSQL(loadMode))
 	if err != nil {
 		tx.Rollback()
 		dl.CompleteDataRefresh(ctx, logID, rowsProcessed, err)
@@ -190,6 +231,7 @@ func (dl *DataLoader) RefreshData(ctx context.Context, filePath string, triggere
 
 	batch := 0
 	batchSize := dl.config.RefreshBatchSize
+	totals := newControlTotals()
 
 	for {
 		batch++
@@ -206,7 +248,10 @@ func (dl *DataLoader) RefreshData(ctx context.Context, filePath string, triggere
 				return fmt.Errorf("error reading CSV record: %w", err)
 			}
 
-			err = dl.processRecord(ctx, tx, record, columnMap, insertCustomerStmt, insertProductStmt, insertOrderStmt, insertOrderItemStmt)
+			line, _ := reader.FieldPos(0)
+			lineage := recordLineage{LogID: logID, SourceID: sourceID, Line: line}
+
+			err = dl.processRecord(ctx, tx, lineage, totals, record, columnMap, insertCustomerStmt, insertProductStmt, insertOrderStmt, insertOrderItemStmt)
 			if err != nil {
 				tx.Rollback()
 				dl.CompleteDataRefresh(ctx, logID, rowsProcessed, err)
@@ -224,18 +269,49 @@ func (dl *DataLoader) RefreshData(ctx context.Context, filePath string, triggere
 		dl.logger.Printf("Processed batch %d (%d rows so far)", batch, rowsProcessed)
 	}
 
+	if err := rebuildDimensionHistory(ctx, tx, logID); err != nil {
+		tx.Rollback()
+		dl.CompleteDataRefresh(ctx, logID, rowsProcessed, err)
+		return err
+	}
+
 	if err := tx.Commit(); err != nil {
 		dl.CompleteDataRefresh(ctx, logID, rowsProcessed, err)
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	return dl.CompleteDataRefresh(ctx, logID, rowsProcessed, nil)
+	// Compare the committed data against the file, a mismatch marks the refresh as failed
+	if err := dl.reconcile(ctx, logID, totals); err != nil {
+		dl.CompleteDataRefresh(ctx, logID, rowsProcessed, err)
+		return err
+	}
+
+	if err := dl.CompleteDataRefresh(ctx, logID, rowsProcessed, nil); err != nil {
+		return err
+	}
+
+	dl.runPostRefreshHooks(ctx, logID)
+	return nil
+}
+
+// runPostRefreshHooks runs the hooks registered with OnRefreshCompleted after a successful refresh
+// A failing hook is only logged, the data itself has already been loaded
+func (dl *DataLoader) runPostRefreshHooks(ctx context.Context, logID int) {
+	for _, hook := range dl.postRefreshHooks {
+		if err := hook.run(ctx, logID); err != nil {
+			dl.logger.Printf("Post refresh step %s failed for refresh %d: %v", hook.name, logID, err)
+			continue
+		}
+		dl.logger.Printf("Post refresh step %s completed for refresh %d", hook.name, logID)
+	}
 }
 
 // processRecord processes a single CSV record
 func (dl *DataLoader) processRecord(
 	ctx context.Context,
 	tx *sql.Tx,
+	lineage recordLineage,
+	totals *controlTotals,
 	record []string,
 	columnMap map[string]int,
 	customerStmt *sql.Stmt,
@@ -379,63 +455,89 @@ func (dl *DataLoader) processRecord(
 		return fmt.Errorf("failed to insert/get payment method: %w", err)
 	}
 
+	// Rows older than the customer's latest observation don't overwrite the current attributes,
+	// so loading an old file after a newer one keeps the newer values
 	_, err = customerStmt.ExecContext(
 		ctx,
 		customerID,
 		customerName,
 		customerEmail,
 		customerAddress,
+		nameAddressKey(customerName, customerAddress),
+		addressCity(customerAddress),
+		saleDate,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to insert customer: %w", err)
 	}
 
+	if err := observeCustomer(ctx, tx, lineage.LogID, customerID, customerName, customerEmail, customerAddress, saleDate); err != nil {
+		return err
+	}
+
+	if err := dl.resolveCustomerIdentity(ctx, tx, lineage.LogID, customerID); err != nil {
+		return err
+	}
+
 	_, err = productStmt.ExecContext(
 		ctx,
 		productID,
 		productName,
 		category,
+		saleDate,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to insert product: %w", err)
 	}
 
-	var orderExists bool
-	err = tx.QueryRowContext(
+	if err := observeProduct(ctx, tx, lineage.LogID, productID, productName, category, saleDate); err != nil {
+		return err
+	}
+
+	// Existing orders are skipped or overwritten depending on the load mode
+	_, err = orderStmt.ExecContext(
 		ctx,
-		"SELECT EXISTS(SELECT 1 FROM orders WHERE order_id = $1)",
 		orderID,
-	).Scan(&orderExists)
+		customerID,
+		regionID,
+		saleDate,
+		shippingCost,
+		paymentMethodID,
+		lineage.SourceID,
+		lineage.Line,
+		lineage.LogID,
+	)
 	if err != nil {
-		return fmt.Errorf("failed to check if order exists: %w", err)
-	}
-
-	if !orderExists {
-		_, err = orderStmt.ExecContext(
-			ctx,
-			orderID,
-			customerID,
-			regionID,
-			saleDate,
-			shippingCost,
-			paymentMethodID,
-		)
-		if err != nil {
-			return fmt.Errorf("failed to insert order: %w", err)
-		}
+		return fmt.Errorf("failed to insert order: %w", err)
+	}
+
+	// Order items are keyed on order and product, a second line would silently overwrite the first
+	if first, dup := totals.seenItem(orderID, productID, lineage.Line); dup {
+		return fmt.Errorf("order %s has product %s on lines %d and %d, each product can only appear once per order", orderID, productID, first, lineage.Line)
 	}
 
-	_, err = orderItemStmt.ExecContext(
+	result, err := orderItemStmt.ExecContext(
 		ctx,
 		orderID,
 		productID,
 		quantitySold,
 		unitPrice,
 		discount,
+		lineage.SourceID,
+		lineage.Line,
+		lineage.LogID,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to insert order item: %w", err)
 	}
 
+	// In append mode items that are already loaded are left alone, so they aren't part of this refresh
+	if written, _ := result.RowsAffected(); written == 0 {
+		totals.skip()
+		return nil
+	}
+
+	totals.add(orderID, quantitySold, unitPrice, discount)
+
 	return nil
 }
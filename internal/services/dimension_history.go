@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// observeProduct records the product attributes seen on a sale. One observation is kept per sale date,
+// a later row for the same date replaces it. History is rebuilt from the observations by rebuildDimensionHistory.
+func observeProduct(ctx context.Context, tx *sql.Tx, logID int, productID, name, category string, saleDate time.Time) error {
+	_, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO product_observations (product_id, sale_date, name, category, log_id)
+         VALUES ($1, $2, $3, $4, $5)
+         ON CONFLICT (product_id, sale_date) DO UPDATE
+         SET name = $3, category = $4, log_id = $5`,
+		productID, saleDate, name, category, logID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record product observation: %w", err)
+	}
+	return nil
+}
+
+// observeCustomer does the same as observeProduct for customer name, email and address
+func observeCustomer(ctx context.Context, tx *sql.Tx, logID int, customerID, name, email, address string, saleDate time.Time) error {
+	_, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO customer_observations (customer_id, sale_date, name, email, address, log_id)
+         VALUES ($1, $2, $3, $4, $5, $6)
+         ON CONFLICT (customer_id, sale_date) DO UPDATE
+         SET name = $3, email = $4, address = $5, log_id = $6`,
+		customerID, saleDate, name, email, address, logID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record customer observation: %w", err)
+	}
+	return nil
+}
+
+// Rebuild the history of the given products or customers ($1) from all of their observations:
+// a new version starts on the first sale date whose attributes differ from the previous sale date's,
+// and the first version is valid for every earlier sale. Out of order rows and backfilled files
+// end up with the same history as a file sorted by date.
+const (
+	rebuildProductHistorySQL = `
+		INSERT INTO product_history (product_id, name, category, valid_from, valid_to)
+		SELECT
+			product_id,
+			name,
+			category,
+			CASE WHEN ROW_NUMBER() OVER w = 1 THEN '-infinity'::date ELSE sale_date END,
+			LEAD(sale_date) OVER w
+		FROM (
+			SELECT
+				product_id, name, category, sale_date,
+				(name, category) IS DISTINCT FROM (LAG(name) OVER w, LAG(category) OVER w) as changed
+			FROM product_observations
+			WHERE product_id = ANY($1)
+			WINDOW w AS (PARTITION BY product_id ORDER BY sale_date)
+		) observations
+		WHERE changed
+		WINDOW w AS (PARTITION BY product_id ORDER BY sale_date)`
+
+	rebuildCustomerHistorySQL = `
+		INSERT INTO customer_history (customer_id, name, email, address, valid_from, valid_to)
+		SELECT
+			customer_id,
+			name,
+			email,
+			address,
+			CASE WHEN ROW_NUMBER() OVER w = 1 THEN '-infinity'::date ELSE sale_date END,
+			LEAD(sale_date) OVER w
+		FROM (
+			SELECT
+				customer_id, name, email, address, sale_date,
+				(name, email, address) IS DISTINCT FROM (LAG(name) OVER w, LAG(email) OVER w, LAG(address) OVER w) as changed
+			FROM customer_observations
+			WHERE customer_id = ANY($1)
+			WINDOW w AS (PARTITION BY customer_id ORDER BY sale_date)
+		) observations
+		WHERE changed
+		WINDOW w AS (PARTITION BY customer_id ORDER BY sale_date)`
+)
+
+// rebuildDimensionHistory rebuilds product_history and customer_history for everything observed in a refresh
+func rebuildDimensionHistory(ctx context.Context, tx *sql.Tx, logID int) error {
+	productIDs, err := queryIDs(ctx, tx, `SELECT DISTINCT product_id FROM product_observations WHERE log_id = $1`, logID)
+	if err != nil {
+		return fmt.Errorf("failed to get observed products: %w", err)
+	}
+	customerIDs, err := queryIDs(ctx, tx, `SELECT DISTINCT customer_id FROM customer_observations WHERE log_id = $1`, logID)
+	if err != nil {
+		return fmt.Errorf("failed to get observed customers: %w", err)
+	}
+
+	return rebuildHistory(ctx, tx, productIDs, customerIDs)
+}
+
+// clearObservations deletes the observations of sales between from and to, which a partition replace is about
+// to delete, and rebuilds the history of every product and customer that lost one from what is left.
+// Otherwise the history and the newer observation check on the upserts would keep using deleted sales.
+func clearObservations(ctx context.Context, tx *sql.Tx, from, to time.Time) error {
+	productIDs, err := queryIDs(ctx, tx, `
+		DELETE FROM product_observations WHERE sale_date BETWEEN $1 AND $2 RETURNING product_id
+	`, from, to)
+	if err != nil {
+		return fmt.Errorf("failed to delete product observations in range: %w", err)
+	}
+	customerIDs, err := queryIDs(ctx, tx, `
+		DELETE FROM customer_observations WHERE sale_date BETWEEN $1 AND $2 RETURNING customer_id
+	`, from, to)
+	if err != nil {
+		return fmt.Errorf("failed to delete customer observations in range: %w", err)
+	}
+
+	return rebuildHistory(ctx, tx, productIDs, customerIDs)
+}
+
+// clearAllObservations deletes every observation and all history, for a full replace
+// The history of everything in the new file is rebuilt from its observations once it is loaded.
+func clearAllObservations(ctx context.Context, tx *sql.Tx) error {
+	for _, table := range []string{"product_observations", "product_history", "customer_observations", "customer_history"} {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table); err != nil {
+			return fmt.Errorf("failed to clear %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// rebuildHistory replaces the history of the given products and customers with one rebuilt from their observations
+func rebuildHistory(ctx context.Context, tx *sql.Tx, productIDs, customerIDs []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM product_history WHERE product_id = ANY($1)`, pq.Array(productIDs)); err != nil {
+		return fmt.Errorf("failed to clear product history: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, rebuildProductHistorySQL, pq.Array(productIDs)); err != nil {
+		return fmt.Errorf("failed to rebuild product history: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM customer_history WHERE customer_id = ANY($1)`, pq.Array(customerIDs)); err != nil {
+		return fmt.Errorf("failed to clear customer history: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, rebuildCustomerHistorySQL, pq.Array(customerIDs)); err != nil {
+		return fmt.Errorf("failed to rebuild customer history: %w", err)
+	}
+
+	return nil
+}
+
+// queryIDs runs a query returning one ID per row and collects the distinct IDs
+func queryIDs(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	seen := make(map[string]struct{})
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		if _, ok := seen[id]; !ok {
+			seen[id] = struct{}{}
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, rows.Err()
+}
@@ -0,0 +1,275 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/prajwalbharadwajbm/backend_assessment/internal/models"
+)
+
+// DefaultDiscountBands are the lower edges of the discount bands after "no discount"
+var DefaultDiscountBands = []float64{0.05, 0.1, 0.2, 0.3, 0.5}
+
+// listRevenueExpr is the revenue of a single order item before discount
+const listRevenueExpr = `(oi.unit_price * oi.quantity)`
+
+// Groupings for discount leakage, the first column is the key and the second the display name
+// Rows are grouped by the key only, so the display name must be the key or an aggregate
+var leakageGroups = map[string][2]string{
+	"product":  {"p.product_id", latestProductAttribute("p.name")},
+	"category": {"p.category", "p.category"},
+	"region":   {"r.name", "r.name"},
+}
+
+// ValidateDiscountBands checks that band edges are ascending discount fractions
+func ValidateDiscountBands(edges []float64) error {
+	if len(edges) == 0 {
+		return errors.New("invalid bands: at least one band edge is required")
+	}
+	for i, edge := range edges {
+		if edge <= 0 || edge > 1 || (i > 0 && edge <= edges[i-1]) {
+			return errors.New("invalid bands: edges must be ascending and between 0 and 1")
+		}
+	}
+	return nil
+}
+
+// discountBandLabel names the band WIDTH_BUCKET placed a discount in, -1 is used for undiscounted items
+func discountBandLabel(bucket int, edges []float64) string {
+	switch {
+	case bucket < 0:
+		return "none"
+	case bucket == 0:
+		return fmt.Sprintf("0-%g%%", edges[0]*100)
+	case bucket == len(edges):
+		return fmt.Sprintf("%g%%+", edges[bucket-1]*100)
+	default:
+		return fmt.Sprintf("%g-%g%%", edges[bucket-1]*100, edges[bucket]*100)
+	}
+}
+
+// GetRevenueByDiscountBand groups order items into discount bands and returns revenue, units and
+// the revenue given away in each. edges are the ascending lower edges of the bands, items without
+// a discount get a band of their own.
+func (as *AnalyticsService) GetRevenueByDiscountBand(ctx context.Context, f models.Filter, edges []float64) ([]map[string]interface{}, error) {
+	if err := ValidateDiscountBands(edges); err != nil {
+		return nil, err
+	}
+
+	from, err := revenueFrom(f.AsOf)
+	if err != nil {
+		return nil, err
+	}
+
+	qa := &queryArgs{}
+	bucket := `CASE WHEN oi.discount = 0 THEN -1 ELSE WIDTH_BUCKET(oi.discount, ` + qa.add(pq.Array(edges)) + `::numeric[]) END`
+
+	query := `
+		SELECT
+			` + bucket + ` as band,
+			COUNT(*) as order_lines,
+			COUNT(DISTINCT o.order_id) as orders,
+			COALESCE(SUM(oi.quantity), 0) as units,
+			COALESCE(SUM(` + listRevenueExpr + `), 0) as list_revenue,
+			COALESCE(SUM(` + revenueExpr + `), 0) as revenue,
+			AVG(oi.quantity) as avg_quantity
+		` + from + `
+		` + whereClause(f, qa) + `
+		GROUP BY 1
+		ORDER BY 1
+	`
+
+	rows, err := as.db.QueryContext(ctx, query, qa.values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []map[string]interface{}
+	var totalRevenue float64
+
+	for rows.Next() {
+		var band, orderLines, orders, units int
+		var listRevenue, revenue, avgQuantity float64
+
+		if err := rows.Scan(&band, &orderLines, &orders, &units, &listRevenue, &revenue, &avgQuantity); err != nil {
+			return nil, err
+		}
+
+		totalRevenue += revenue
+		results = append(results, map[string]interface{}{
+			"band":         discountBandLabel(band, edges),
+			"order_lines":  orderLines,
+			"orders":       orders,
+			"units":        units,
+			"list_revenue": listRevenue,
+			"revenue":      revenue,
+			"leakage":      listRevenue - revenue,
+			"avg_quantity": avgQuantity,
+		})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, row := range results {
+		row["revenue_share"] = 0.0
+		if totalRevenue != 0 {
+			row["revenue_share"] = row["revenue"].(float64) / totalRevenue
+		}
+	}
+
+	return results, nil
+}
+
+// GetDiscountLeakage returns the revenue given away through discounts (list price revenue minus net revenue)
+// by product, category or region, largest leakage first
+func (as *AnalyticsService) GetDiscountLeakage(ctx context.Context, f models.Filter, groupBy string) ([]map[string]interface{}, error) {
+	group, ok := leakageGroups[groupBy]
+	if !ok {
+		return nil, errors.New("invalid group_by: must be 'product', 'category' or 'region'")
+	}
+
+	from, err := revenueFrom(f.AsOf)
+	if err != nil {
+		return nil, err
+	}
+
+	qa := &queryArgs{}
+	query := `
+		SELECT
+			` + group[0] + `,
+			` + group[1] + `,
+			COALESCE(SUM(` + listRevenueExpr + `), 0) as list_revenue,
+			COALESCE(SUM(` + revenueExpr + `), 0) as revenue,
+			COALESCE(SUM(oi.quantity) FILTER (WHERE oi.discount > 0), 0) as discounted_units,
+			COALESCE(SUM(oi.quantity), 0) as units
+		` + from + `
+		JOIN regions r ON r.region_id = o.region_id
+		` + whereClause(f, qa) + `
+		GROUP BY ` + group[0] + `
+		ORDER BY list_revenue - revenue DESC
+		` + limitClause(f, qa) + `
+	`
+
+	rows, err := as.db.QueryContext(ctx, query, qa.values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []map[string]interface{}
+
+	for rows.Next() {
+		var key, name string
+		var listRevenue, revenue float64
+		var discountedUnits, units int
+
+		if err := rows.Scan(&key, &name, &listRevenue, &revenue, &discountedUnits, &units); err != nil {
+			return nil, err
+		}
+
+		leakage := listRevenue - revenue
+		row := map[string]interface{}{
+			groupBy:            key,
+			"list_revenue":     listRevenue,
+			"revenue":          revenue,
+			"leakage":          leakage,
+			"leakage_pct":      0.0,
+			"discounted_units": discountedUnits,
+			"units":            units,
+		}
+		if groupBy == "product" {
+			row["name"] = name
+		}
+		if listRevenue != 0 {
+			row["leakage_pct"] = leakage / listRevenue * 100
+		}
+
+		results = append(results, row)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// GetDiscountQuantityRelationship shows for each product whether discounts sell more units per order line:
+// the average quantity at full price and when discounted, the correlation between discount and quantity,
+// and the regression slope (extra units per line for each additional 10 points of discount).
+// Correlation and slope are nil for products whose discount never varies.
+func (as *AnalyticsService) GetDiscountQuantityRelationship(ctx context.Context, f models.Filter) ([]map[string]interface{}, error) {
+	from, err := revenueFrom(f.AsOf)
+	if err != nil {
+		return nil, err
+	}
+
+	qa := &queryArgs{}
+	query := `
+		SELECT
+			p.product_id,
+			` + latestProductAttribute("p.name") + ` as name,
+			COUNT(*) as order_lines,
+			COUNT(*) FILTER (WHERE oi.discount > 0) as discounted_lines,
+			AVG(oi.discount) as avg_discount,
+			AVG(oi.quantity) FILTER (WHERE oi.discount = 0) as avg_quantity_full_price,
+			AVG(oi.quantity) FILTER (WHERE oi.discount > 0) as avg_quantity_discounted,
+			CORR(oi.discount, oi.quantity) as correlation,
+			REGR_SLOPE(oi.quantity, oi.discount) / 10 as units_per_10pt
+		` + from + `
+		` + whereClause(f, qa) + `
+		GROUP BY p.product_id
+		ORDER BY order_lines DESC
+		` + limitClause(f, qa) + `
+	`
+
+	rows, err := as.db.QueryContext(ctx, query, qa.values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []map[string]interface{}
+
+	for rows.Next() {
+		var productID, name string
+		var orderLines, discountedLines int
+		var avgDiscount float64
+		var fullPrice, discounted, correlation, slope *float64
+
+		if err := rows.Scan(&productID, &name, &orderLines, &discountedLines, &avgDiscount, &fullPrice, &discounted, &correlation, &slope); err != nil {
+			return nil, err
+		}
+
+		// Relative change in units per line when discounted, only when both sides were sold
+		var quantityLift *float64
+		if fullPrice != nil && discounted != nil && *fullPrice != 0 {
+			lift := (*discounted - *fullPrice) / *fullPrice * 100
+			quantityLift = &lift
+		}
+
+		results = append(results, map[string]interface{}{
+			"product_id":              productID,
+			"name":                    name,
+			"order_lines":             orderLines,
+			"discounted_lines":        discountedLines,
+			"avg_discount":            avgDiscount,
+			"avg_quantity_full_price": fullPrice,
+			"avg_quantity_discounted": discounted,
+			"quantity_lift_pct":       quantityLift,
+			"correlation":             correlation,
+			"units_per_10pt":          slope,
+		})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+
+	"github.com/lib/pq"
+	"github.com/prajwalbharadwajbm/backend_assessment/internal/models"
+)
+
+// Per order metrics a distribution can be computed for
+const (
+	// DistributionOrderValue is the revenue of an order
+	DistributionOrderValue = "order_value"
+	// DistributionBasketSize is the number of units in an order
+	DistributionBasketSize = "basket_size"
+)
+
+// DefaultPercentiles are reported when no percentiles are requested
+var DefaultPercentiles = []float64{25, 50, 75, 90, 99}
+
+// ValidateDistribution checks the metric, bin count and percentiles of a distribution request
+func ValidateDistribution(metric string, bins int, percentiles []float64) error {
+	if metric != DistributionOrderValue && metric != DistributionBasketSize {
+		return errors.New("invalid metric: must be 'order_value' or 'basket_size'")
+	}
+	if bins < 1 {
+		return errors.New("invalid bins: must be at least 1")
+	}
+	for _, p := range percentiles {
+		if p <= 0 || p >= 100 {
+			return errors.New("invalid percentiles: must be between 0 and 100")
+		}
+	}
+	return nil
+}
+
+// GetOrderDistribution returns the distribution of a per order metric over the orders matching the filter:
+// count, min, max, mean, standard deviation, median and the requested percentiles (0-100, computed with
+// PERCENTILE_CONT), and a histogram with bins equal width bins between the smallest and largest order.
+// Item level filters such as category only count the matching items of each order.
+func (as *AnalyticsService) GetOrderDistribution(ctx context.Context, f models.Filter, metric string, bins int, percentiles []float64) (map[string]interface{}, []map[string]interface{}, error) {
+	if err := ValidateDistribution(metric, bins, percentiles); err != nil {
+		return nil, nil, err
+	}
+
+	fractions := make([]float64, len(percentiles))
+	for i, p := range percentiles {
+		fractions[i] = p / 100
+	}
+
+	from, err := revenueFrom(f.AsOf)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var value string
+	switch metric {
+	case DistributionOrderValue:
+		value, err = revenueMeasure(f.RevenueBasis)
+		if err != nil {
+			return nil, nil, err
+		}
+	case DistributionBasketSize:
+		value = "oi.quantity"
+	}
+
+	// Each query numbers its own placeholders, so the per order CTE is built once per query
+	perOrder := func(qa *queryArgs) string {
+		return `per_order AS (
+			SELECT o.order_id, SUM(` + value + `)::float as value
+			` + from + `
+			` + whereClause(f, qa) + `
+			GROUP BY o.order_id
+		)`
+	}
+
+	statsArgs := &queryArgs{}
+	statsCTE := perOrder(statsArgs)
+	percentileArg := statsArgs.add(pq.Array(fractions))
+
+	var count int
+	var minValue, maxValue, mean, stddev, median *float64
+	var percentileValues []sql.NullFloat64
+	err = as.db.QueryRowContext(ctx, `
+		WITH `+statsCTE+`
+		SELECT
+			COUNT(*),
+			MIN(value),
+			MAX(value),
+			AVG(value),
+			STDDEV_SAMP(value),
+			PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY value),
+			PERCENTILE_CONT(`+percentileArg+`::float8[]) WITHIN GROUP (ORDER BY value)
+		FROM per_order
+	`, statsArgs.values...).Scan(&count, &minValue, &maxValue, &mean, &stddev, &median, pq.Array(&percentileValues))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	summary := map[string]interface{}{
+		"metric": metric,
+		"orders": count,
+		"min":    minValue,
+		"max":    maxValue,
+		"mean":   mean,
+		"stddev": stddev,
+		"median": median,
+	}
+	for i, p := range percentiles {
+		var v *float64
+		if i < len(percentileValues) && percentileValues[i].Valid {
+			v = &percentileValues[i].Float64
+		}
+		summary["p"+strconv.FormatFloat(p, 'f', -1, 64)] = v
+	}
+
+	if count == 0 {
+		return summary, []map[string]interface{}{}, nil
+	}
+
+	histArgs := &queryArgs{}
+	histCTE := perOrder(histArgs)
+	binsArg := histArgs.add(bins)
+
+	// Orders on the upper edge belong to the last bin, and with a single distinct value every order is in bin 1
+	rows, err := as.db.QueryContext(ctx, `
+		WITH `+histCTE+`,
+		bounds AS (
+			SELECT MIN(value) as lo, MAX(value) as hi FROM per_order
+		)
+		SELECT
+			CASE WHEN b.hi = b.lo THEN 1 ELSE LEAST(WIDTH_BUCKET(po.value, b.lo, b.hi, `+binsArg+`), `+binsArg+`) END as bin,
+			COUNT(*) as orders
+		FROM per_order po
+		CROSS JOIN bounds b
+		GROUP BY 1
+	`, histArgs.values...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[int]int, bins)
+	for rows.Next() {
+		var bin, orders int
+		if err := rows.Scan(&bin, &orders); err != nil {
+			return nil, nil, err
+		}
+		counts[bin] = orders
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	width := (*maxValue - *minValue) / float64(bins)
+	histogram := make([]map[string]interface{}, 0, bins)
+	for bin := 1; bin <= bins; bin++ {
+		histogram = append(histogram, map[string]interface{}{
+			"bin":         bin,
+			"lower_bound": *minValue + width*float64(bin-1),
+			"upper_bound": *minValue + width*float64(bin),
+			"orders":      counts[bin],
+			"share":       float64(counts[bin]) / float64(count),
+		})
+	}
+
+	return summary, histogram, nil
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/prajwalbharadwajbm/backend_assessment/internal/models"
+)
+
+// revenueExpr is the net revenue of a single order item
+const revenueExpr = `(oi.unit_price * oi.quantity) * (1 - oi.discount)`
+
+// shippingShareExpr spreads an order's shipping cost evenly over its items,
+// so shipping can be summed at item level without counting it once per item
+const shippingShareExpr = `(o.shipping_cost / (SELECT COUNT(*) FROM order_items x WHERE x.order_id = o.order_id))`
+
+// Revenue definitions, picked per request with revenue_basis
+const (
+	// RevenueProduct is item revenue after discount, without shipping
+	RevenueProduct = "product"
+	// RevenueWithShipping adds the shipping charged on the order
+	RevenueWithShipping = "with_shipping"
+	// RevenueNetOfShipping takes the shipping cost off product revenue
+	RevenueNetOfShipping = "net_of_shipping"
+)
+
+// revenueMeasure returns the revenue of a single order item under a revenue definition
+// Shipping is spread over the order's items, see shippingShareExpr
+func revenueMeasure(basis string) (string, error) {
+	switch basis {
+	case RevenueProduct, "":
+		return revenueExpr, nil
+	case RevenueWithShipping:
+		return "(" + revenueExpr + " + " + shippingShareExpr + ")", nil
+	case RevenueNetOfShipping:
+		return "(" + revenueExpr + " - " + shippingShareExpr + ")", nil
+	default:
+		return "", errors.New("invalid revenue_basis: must be 'product', 'with_shipping' or 'net_of_shipping'")
+	}
+}
+
+// queryArgs collects the positional arguments of a query as conditions are added to it
+type queryArgs struct {
+	values []interface{}
+}
+
+// add appends an argument and returns its placeholder
+func (qa *queryArgs) add(value interface{}) string {
+	qa.values = append(qa.values, value)
+	return fmt.Sprintf("$%d", len(qa.values))
+}
+
+// revenueFrom returns the FROM clause shared by the revenue queries: order items as oi,
+// orders as o and products as p (current or as of the sale date, see productSource)
+func revenueFrom(asOf string) (string, error) {
+	productJoin, err := productSource(asOf)
+	if err != nil {
+		return "", err
+	}
+
+	return `FROM order_items oi
+		JOIN orders o ON oi.order_id = o.order_id
+		` + productJoin, nil
+}
+
+// filterConditions turns a filter into parameterized conditions on the aliases from revenueFrom
+// Every multi-valued filter matches any of its values, filters are combined with AND
+func filterConditions(f models.Filter, qa *queryArgs) []string {
+	conditions := []string{
+		"o.sale_date BETWEEN " + qa.add(f.StartDate) + " AND " + qa.add(f.EndDate),
+	}
+
+	if len(f.Categories) > 0 {
+		conditions = append(conditions, "p.category = ANY("+qa.add(pq.Array(f.Categories))+")")
+	}
+	if len(f.Regions) > 0 {
+		conditions = append(conditions, "o.region_id IN (SELECT region_id FROM regions WHERE name = ANY("+qa.add(pq.Array(f.Regions))+"))")
+	}
+	if len(f.ProductIDs) > 0 {
+		conditions = append(conditions, "oi.product_id = ANY("+qa.add(pq.Array(f.ProductIDs))+")")
+	}
+	if len(f.CustomerIDs) > 0 {
+		conditions = append(conditions, "o.customer_id = ANY("+qa.add(pq.Array(f.CustomerIDs))+")")
+	}
+	if len(f.PaymentMethods) > 0 {
+		conditions = append(conditions, "o.payment_method_id IN (SELECT payment_method_id FROM payment_methods WHERE name = ANY("+qa.add(pq.Array(f.PaymentMethods))+"))")
+	}
+
+	return conditions
+}
+
+// whereClause builds the WHERE clause for a filter
+func whereClause(f models.Filter, qa *queryArgs) string {
+	return "WHERE " + strings.Join(filterConditions(f, qa), " AND ")
+}
+
+// limitClause returns a LIMIT for the filter, or nothing when no limit is set
+func limitClause(f models.Filter, qa *queryArgs) string {
+	if f.Limit <= 0 {
+		return ""
+	}
+	return "LIMIT " + qa.add(f.Limit)
+}
@@ -0,0 +1,470 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/prajwalbharadwajbm/backend_assessment/internal/models"
+)
+
+// Forecasting methods
+const (
+	// ForecastHoltWinters is additive triple exponential smoothing, falling back to Holt's linear trend
+	// when the history is shorter than two seasons
+	ForecastHoltWinters = "holt_winters"
+	// ForecastLinear is a least squares trend line plus additive seasonal offsets
+	ForecastLinear = "linear"
+)
+
+// Fewest periods of history a forecast is fitted on
+const minForecastHistory = 3
+
+// ErrInsufficientHistory is returned when the filter leaves too few complete periods to fit a forecast on
+var ErrInsufficientHistory = errors.New("not enough history to forecast")
+
+// defaultSeasonLength is the number of periods in a yearly (or weekly for daily data) cycle for each interval
+var defaultSeasonLength = map[string]int{
+	"daily":     7,
+	"weekly":    52,
+	"monthly":   12,
+	"quarterly": 4,
+	"yearly":    0,
+}
+
+// ForecastOptions configures GetRevenueForecast
+type ForecastOptions struct {
+	// Interval of the revenue series, same values as GetRevenueOverTime
+	Interval string
+	// Method is ForecastHoltWinters or ForecastLinear
+	Method string
+	// Periods is the number of future periods to forecast
+	Periods int
+	// SeasonLength in periods, 0 uses the default for the interval and a negative one disables seasonality
+	SeasonLength int
+	// Confidence of the prediction interval, e.g. 0.95
+	Confidence float64
+	// GroupBy "category" or "region" fits a separate forecast per group, empty forecasts the total
+	GroupBy string
+}
+
+// forecastModel is a fitted model, predict returns the point forecast h periods after the last observation
+// and sigma is the standard deviation of the one step ahead in-sample errors
+type forecastModel struct {
+	method  string
+	params  map[string]float64
+	sigma   float64
+	rmse    float64
+	predict func(h int) float64
+}
+
+// GetRevenueForecast fits a time-series model on the revenue over time series for the filter
+// and forecasts the next periods with a prediction interval, either for the total or for each category or region.
+// Groups with too little history, such as a category that only started selling, are returned with
+// insufficient_history set and an error instead of a forecast, so they don't fail the other groups.
+func (as *AnalyticsService) GetRevenueForecast(ctx context.Context, f models.Filter, opts ForecastOptions) ([]map[string]interface{}, error) {
+	if opts.Periods < 1 {
+		return nil, errors.New("invalid periods: must be at least 1")
+	}
+	if opts.Confidence <= 0 || opts.Confidence >= 1 {
+		return nil, errors.New("invalid confidence: must be between 0 and 1")
+	}
+	if opts.Method != ForecastHoltWinters && opts.Method != ForecastLinear {
+		return nil, errors.New("invalid method: must be 'holt_winters' or 'linear'")
+	}
+	if _, _, err := timeBucket(opts.Interval); err != nil {
+		return nil, err
+	}
+
+	var groups []map[string]interface{}
+	var err error
+	switch opts.GroupBy {
+	case "":
+		forecast, err := as.forecastSeries(ctx, f, opts)
+		if err != nil {
+			return nil, err
+		}
+		return []map[string]interface{}{forecast}, nil
+	case "category":
+		groups, err = as.GetRevenueByCategory(ctx, f)
+	case "region":
+		groups, err = as.GetRevenueByRegion(ctx, f)
+	default:
+		return nil, errors.New("invalid group_by: must be 'category' or 'region'")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var results []map[string]interface{}
+	for _, group := range groups {
+		name := group[opts.GroupBy].(string)
+
+		groupFilter := f
+		if opts.GroupBy == "category" {
+			groupFilter.Categories = []string{name}
+		} else {
+			groupFilter.Regions = []string{name}
+		}
+
+		forecast, err := as.forecastSeries(ctx, groupFilter, opts)
+		if errors.Is(err, ErrInsufficientHistory) {
+			results = append(results, map[string]interface{}{
+				opts.GroupBy:           name,
+				"insufficient_history": true,
+				"error":                err.Error(),
+			})
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", opts.GroupBy, name, err)
+		}
+		forecast[opts.GroupBy] = name
+		results = append(results, forecast)
+	}
+
+	return results, nil
+}
+
+// forecastSeries fits the model on a single revenue series and forecasts it
+func (as *AnalyticsService) forecastSeries(ctx context.Context, f models.Filter, opts ForecastOptions) (map[string]interface{}, error) {
+	unit, _, err := timeBucket(opts.Interval)
+	if err != nil {
+		return nil, err
+	}
+
+	seasonLength := opts.SeasonLength
+	if seasonLength == 0 {
+		seasonLength = defaultSeasonLength[opts.Interval]
+	}
+
+	// The current period is still filling up and would drag the trend and level down,
+	// so the model is fitted on complete periods only
+	end, err := time.Parse("2006-01-02", f.EndDate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid end_date: %w", err)
+	}
+	end = completePeriodsEnd(unit, end)
+	if end.Format("2006-01-02") < f.StartDate {
+		return nil, fmt.Errorf("%w: no complete %s between start_date and end_date", ErrInsufficientHistory, unit)
+	}
+	f.EndDate = end.Format("2006-01-02")
+
+	series, err := as.GetRevenueOverTime(ctx, f, opts.Interval, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Periods before the first sale are gap filled with zeros, they aren't history
+	series = trimLeadingEmptyPeriods(series)
+
+	values := make([]float64, len(series))
+	for i, row := range series {
+		values[i] = row["revenue"].(float64)
+	}
+
+	if len(values) < minForecastHistory {
+		return nil, fmt.Errorf("%w: need at least %d periods, got %d", ErrInsufficientHistory, minForecastHistory, len(values))
+	}
+
+	model := fitLinearTrend(values, seasonLength)
+	if opts.Method == ForecastHoltWinters {
+		model = fitHoltWinters(values, seasonLength)
+	}
+
+	// Two sided normal quantile for the confidence level
+	z := math.Sqrt2 * math.Erfinv(opts.Confidence)
+
+	period := truncateToPeriod(unit, end)
+
+	forecast := make([]map[string]interface{}, 0, opts.Periods)
+	for h := 1; h <= opts.Periods; h++ {
+		period = nextPeriod(unit, period)
+		point := model.predict(h)
+		// The interval widens with the horizon as errors accumulate
+		margin := z * model.sigma * math.Sqrt(float64(h))
+
+		forecast = append(forecast, map[string]interface{}{
+			"time_period": periodLabel(unit, period),
+			"forecast":    point,
+			"lower":       point - margin,
+			"upper":       point + margin,
+		})
+	}
+
+	return map[string]interface{}{
+		"method":        model.method,
+		"season_length": max(seasonLength, 0),
+		"params":        model.params,
+		"rmse":          model.rmse,
+		"confidence":    opts.Confidence,
+		"history":       series,
+		"forecast":      forecast,
+	}, nil
+}
+
+// fitHoltWinters fits additive Holt-Winters, picking the smoothing parameters with the lowest
+// one step ahead squared error on a coarse grid. Without two full seasons of history it fits
+// Holt's linear trend instead.
+func fitHoltWinters(y []float64, m int) *forecastModel {
+	seasonal := m >= 2 && len(y) >= 2*m
+
+	grid := []float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9}
+	gammas := grid
+	if !seasonal {
+		gammas = []float64{0}
+	}
+
+	bestSSE := math.Inf(1)
+	var bestAlpha, bestBeta, bestGamma float64
+	for _, alpha := range grid {
+		for _, beta := range grid {
+			for _, gamma := range gammas {
+				sse, _ := holtWinters(y, m, seasonal, alpha, beta, gamma)
+				if sse < bestSSE {
+					bestSSE, bestAlpha, bestBeta, bestGamma = sse, alpha, beta, gamma
+				}
+			}
+		}
+	}
+
+	sse, predict := holtWinters(y, m, seasonal, bestAlpha, bestBeta, bestGamma)
+
+	start := 1
+	if seasonal {
+		start = m
+	}
+	errorCount := float64(len(y) - start)
+	sigma := math.Sqrt(sse / errorCount)
+
+	model := &forecastModel{
+		method:  ForecastHoltWinters,
+		params:  map[string]float64{"alpha": bestAlpha, "beta": bestBeta},
+		sigma:   sigma,
+		rmse:    sigma,
+		predict: predict,
+	}
+	if seasonal {
+		model.params["gamma"] = bestGamma
+	} else {
+		model.method = "holt_linear"
+	}
+
+	return model
+}
+
+// holtWinters runs additive exponential smoothing over y and returns the sum of squared
+// one step ahead errors along with the forecast function from the final state
+func holtWinters(y []float64, m int, seasonal bool, alpha, beta, gamma float64) (float64, func(h int) float64) {
+	var level, trend float64
+	var season []float64
+	start := 1
+
+	if seasonal {
+		// Level and seasonal offsets from the first season, trend from the change between the first two seasons
+		var first, second float64
+		for i := 0; i < m; i++ {
+			first += y[i]
+			second += y[i+m]
+		}
+		level = first / float64(m)
+		trend = (second - first) / float64(m*m)
+
+		season = make([]float64, m)
+		for i := 0; i < m; i++ {
+			season[i] = y[i] - level
+		}
+		start = m
+	} else {
+		level = y[0]
+		trend = y[1] - y[0]
+	}
+
+	var sse float64
+	for t := start; t < len(y); t++ {
+		var s float64
+		if seasonal {
+			s = season[t%m]
+		}
+
+		forecast := level + trend + s
+		sse += (y[t] - forecast) * (y[t] - forecast)
+
+		previousLevel := level
+		level = alpha*(y[t]-s) + (1-alpha)*(level+trend)
+		trend = beta*(level-previousLevel) + (1-beta)*trend
+		if seasonal {
+			season[t%m] = gamma*(y[t]-level) + (1-gamma)*s
+		}
+	}
+
+	n := len(y)
+	return sse, func(h int) float64 {
+		forecast := level + float64(h)*trend
+		if seasonal {
+			forecast += season[(n+h-1)%m]
+		}
+		return forecast
+	}
+}
+
+// fitLinearTrend fits a least squares trend line and, with at least two full seasons of history,
+// an additive seasonal offset for each position in the season. Trend and offsets are fitted together
+// (the slope is the pooled slope within each season position), so the pattern inside a season
+// doesn't leak into the trend.
+func fitLinearTrend(y []float64, m int) *forecastModel {
+	n := float64(len(y))
+
+	seasonal := m >= 2 && len(y) >= 2*m
+	positions := 1
+	if seasonal {
+		positions = m
+	}
+
+	// Mean time and value at each season position, a single position without seasonality
+	meanX := make([]float64, positions)
+	meanY := make([]float64, positions)
+	counts := make([]float64, positions)
+	for t, v := range y {
+		meanX[t%positions] += float64(t)
+		meanY[t%positions] += v
+		counts[t%positions]++
+	}
+	for i := range counts {
+		meanX[i] /= counts[i]
+		meanY[i] /= counts[i]
+	}
+
+	var sumXY, sumXX float64
+	for t, v := range y {
+		dx := float64(t) - meanX[t%positions]
+		sumXY += dx * (v - meanY[t%positions])
+		sumXX += dx * dx
+	}
+	slope := sumXY / sumXX
+
+	// Each position's own intercept, split into a shared intercept and offsets that sum to zero
+	var intercept float64
+	season := make([]float64, positions)
+	for i := range season {
+		season[i] = meanY[i] - slope*meanX[i]
+		intercept += season[i] / float64(positions)
+	}
+	for i := range season {
+		season[i] -= intercept
+	}
+
+	fitted := func(t int) float64 {
+		v := intercept + slope*float64(t)
+		if seasonal {
+			v += season[t%m]
+		}
+		return v
+	}
+
+	var sse float64
+	for t, v := range y {
+		sse += (v - fitted(t)) * (v - fitted(t))
+	}
+
+	// Degrees of freedom lost to the trend line and the seasonal offsets
+	dof := n - 2
+	if seasonal {
+		dof -= float64(m - 1)
+	}
+	if dof < 1 {
+		dof = 1
+	}
+
+	params := map[string]float64{"intercept": intercept, "slope": slope}
+	method := ForecastLinear
+	if !seasonal {
+		method = "linear_trend"
+	}
+
+	last := len(y) - 1
+	return &forecastModel{
+		method:  method,
+		params:  params,
+		sigma:   math.Sqrt(sse / dof),
+		rmse:    math.Sqrt(sse / n),
+		predict: func(h int) float64 { return fitted(last + h) },
+	}
+}
+
+// completePeriodsEnd returns the last day of the last period of the DATE_TRUNC unit that is complete on end,
+// which is end itself when it is the last day of its period
+func completePeriodsEnd(unit string, end time.Time) time.Time {
+	end = truncateToPeriod("day", end)
+	start := truncateToPeriod(unit, end)
+	if nextPeriod(unit, start).AddDate(0, 0, -1).After(end) {
+		return start.AddDate(0, 0, -1)
+	}
+	return end
+}
+
+// trimLeadingEmptyPeriods drops the periods without revenue before the first one with revenue
+func trimLeadingEmptyPeriods(series []map[string]interface{}) []map[string]interface{} {
+	for i, row := range series {
+		if row["revenue"].(float64) != 0 {
+			return series[i:]
+		}
+	}
+	return series[:0]
+}
+
+// truncateToPeriod truncates a date to the start of its DATE_TRUNC unit, matching the periods from the database
+func truncateToPeriod(unit string, t time.Time) time.Time {
+	t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+
+	switch unit {
+	case "week":
+		// ISO weeks start on Monday
+		offset := (int(t.Weekday()) + 6) % 7
+		return t.AddDate(0, 0, -offset)
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	case "quarter":
+		month := time.Month((int(t.Month())-1)/3*3 + 1)
+		return time.Date(t.Year(), month, 1, 0, 0, 0, 0, time.UTC)
+	case "year":
+		return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return t
+	}
+}
+
+// nextPeriod returns the start of the period after the given one
+func nextPeriod(unit string, t time.Time) time.Time {
+	switch unit {
+	case "day":
+		return t.AddDate(0, 0, 1)
+	case "week":
+		return t.AddDate(0, 0, 7)
+	case "month":
+		return t.AddDate(0, 1, 0)
+	case "quarter":
+		return t.AddDate(0, 3, 0)
+	default:
+		return t.AddDate(1, 0, 0)
+	}
+}
+
+// periodLabel formats a period the same way timeBucket formats it in SQL
+func periodLabel(unit string, t time.Time) string {
+	switch unit {
+	case "day":
+		return t.Format("2006-01-02")
+	case "week":
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case "month":
+		return t.Format("2006-01")
+	case "quarter":
+		return fmt.Sprintf("%d-Q%d", t.Year(), (int(t.Month())-1)/3+1)
+	default:
+		return t.Format("2006")
+	}
+}
@@ -0,0 +1,230 @@
+package services
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+// seasonalSeries repeats pattern the given number of times
+func seasonalSeries(pattern []float64, seasons int) []float64 {
+	var y []float64
+	for i := 0; i < seasons; i++ {
+		y = append(y, pattern...)
+	}
+	return y
+}
+
+func TestFitLinearTrend(t *testing.T) {
+	tests := []struct {
+		name       string
+		y          []float64
+		m          int
+		wantMethod string
+		want       []float64 // predictions for h = 1, 2, ...
+	}{
+		{
+			name:       "linear series",
+			y:          []float64{3, 5, 7, 9, 11, 13},
+			m:          0,
+			wantMethod: "linear_trend",
+			want:       []float64{15, 17, 19},
+		},
+		{
+			name:       "constant seasonal series",
+			y:          seasonalSeries([]float64{10, 20, 30, 40}, 3),
+			m:          4,
+			wantMethod: ForecastLinear,
+			want:       []float64{10, 20, 30, 40, 10},
+		},
+		{
+			// 100 + 2t plus -5, +5, 0 by position
+			name:       "trend and seasonal series",
+			y:          []float64{95, 107, 104, 101, 113, 110, 107, 119, 116},
+			m:          3,
+			wantMethod: ForecastLinear,
+			want:       []float64{113, 125, 122, 119},
+		},
+		{
+			name:       "too short for seasonality",
+			y:          []float64{3, 5, 7, 9, 11},
+			m:          4,
+			wantMethod: "linear_trend",
+			want:       []float64{13},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := fitLinearTrend(tt.y, tt.m)
+			if model.method != tt.wantMethod {
+				t.Errorf("method = %q, want %q", model.method, tt.wantMethod)
+			}
+			for i, want := range tt.want {
+				if got := model.predict(i + 1); !almostEqual(got, want) {
+					t.Errorf("predict(%d) = %v, want %v", i+1, got, want)
+				}
+			}
+			if !almostEqual(model.rmse, 0) {
+				t.Errorf("rmse = %v, want 0 for an exact fit", model.rmse)
+			}
+		})
+	}
+}
+
+func TestFitHoltWinters(t *testing.T) {
+	tests := []struct {
+		name       string
+		y          []float64
+		m          int
+		wantMethod string
+		want       []float64
+	}{
+		{
+			name:       "linear series",
+			y:          []float64{3, 5, 7, 9, 11, 13},
+			m:          0,
+			wantMethod: "holt_linear",
+			want:       []float64{15, 17, 19},
+		},
+		{
+			name:       "constant seasonal series",
+			y:          seasonalSeries([]float64{10, 20, 30, 40}, 3),
+			m:          4,
+			wantMethod: ForecastHoltWinters,
+			want:       []float64{10, 20, 30, 40, 10},
+		},
+		{
+			name:       "too short for seasonality",
+			y:          []float64{3, 5, 7, 9, 11},
+			m:          4,
+			wantMethod: "holt_linear",
+			want:       []float64{13},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := fitHoltWinters(tt.y, tt.m)
+			if model.method != tt.wantMethod {
+				t.Errorf("method = %q, want %q", model.method, tt.wantMethod)
+			}
+			for i, want := range tt.want {
+				if got := model.predict(i + 1); !almostEqual(got, want) {
+					t.Errorf("predict(%d) = %v, want %v", i+1, got, want)
+				}
+			}
+			if !almostEqual(model.sigma, 0) {
+				t.Errorf("sigma = %v, want 0 for an exact fit", model.sigma)
+			}
+		})
+	}
+}
+
+func TestTruncateToPeriod(t *testing.T) {
+	tests := []struct {
+		unit string
+		in   string
+		want string
+	}{
+		{"day", "2024-02-29", "2024-02-29"},
+		{"week", "2024-01-03", "2024-01-01"},
+		{"week", "2021-01-03", "2020-12-28"}, // Sunday, still in the ISO week that started in December
+		{"month", "2024-02-29", "2024-02-01"},
+		{"quarter", "2024-06-30", "2024-04-01"},
+		{"quarter", "2024-12-31", "2024-10-01"},
+		{"year", "2024-12-31", "2024-01-01"},
+	}
+
+	for _, tt := range tests {
+		if got := truncateToPeriod(tt.unit, date(tt.in)); !got.Equal(date(tt.want)) {
+			t.Errorf("truncateToPeriod(%q, %s) = %s, want %s", tt.unit, tt.in, got.Format("2006-01-02"), tt.want)
+		}
+	}
+}
+
+func TestNextPeriodAndLabel(t *testing.T) {
+	tests := []struct {
+		unit      string
+		start     string
+		wantLabel string
+		wantNext  string
+		nextLabel string
+	}{
+		{"day", "2023-12-31", "2023-12-31", "2024-01-01", "2024-01-01"},
+		{"week", "2020-12-28", "2020-W53", "2021-01-04", "2021-W01"},
+		{"week", "2024-12-23", "2024-W52", "2024-12-30", "2025-W01"}, // ISO week 1 of 2025 starts in December 2024
+		{"month", "2023-12-01", "2023-12", "2024-01-01", "2024-01"},
+		{"quarter", "2023-10-01", "2023-Q4", "2024-01-01", "2024-Q1"},
+		{"year", "2023-01-01", "2023", "2024-01-01", "2024"},
+	}
+
+	for _, tt := range tests {
+		start := date(tt.start)
+		if got := periodLabel(tt.unit, start); got != tt.wantLabel {
+			t.Errorf("periodLabel(%q, %s) = %q, want %q", tt.unit, tt.start, got, tt.wantLabel)
+		}
+
+		next := nextPeriod(tt.unit, start)
+		if !next.Equal(date(tt.wantNext)) {
+			t.Errorf("nextPeriod(%q, %s) = %s, want %s", tt.unit, tt.start, next.Format("2006-01-02"), tt.wantNext)
+		}
+		if got := periodLabel(tt.unit, next); got != tt.nextLabel {
+			t.Errorf("periodLabel(%q, %s) = %q, want %q", tt.unit, tt.wantNext, got, tt.nextLabel)
+		}
+	}
+}
+
+func TestCompletePeriodsEnd(t *testing.T) {
+	tests := []struct {
+		unit string
+		end  string
+		want string
+	}{
+		{"day", "2024-03-15", "2024-03-15"},
+		{"week", "2024-03-17", "2024-03-17"}, // Sunday ends the ISO week
+		{"week", "2024-03-15", "2024-03-10"},
+		{"month", "2024-02-29", "2024-02-29"},
+		{"month", "2024-03-15", "2024-02-29"},
+		{"quarter", "2024-03-31", "2024-03-31"},
+		{"quarter", "2024-05-01", "2024-03-31"},
+		{"year", "2024-01-01", "2023-12-31"},
+	}
+
+	for _, tt := range tests {
+		if got := completePeriodsEnd(tt.unit, date(tt.end)); !got.Equal(date(tt.want)) {
+			t.Errorf("completePeriodsEnd(%q, %s) = %s, want %s", tt.unit, tt.end, got.Format("2006-01-02"), tt.want)
+		}
+	}
+}
+
+func TestTrimLeadingEmptyPeriods(t *testing.T) {
+	series := []map[string]interface{}{
+		{"time_period": "2024-01", "revenue": 0.0},
+		{"time_period": "2024-02", "revenue": 0.0},
+		{"time_period": "2024-03", "revenue": 10.0},
+		{"time_period": "2024-04", "revenue": 0.0},
+		{"time_period": "2024-05", "revenue": 5.0},
+	}
+
+	got := trimLeadingEmptyPeriods(series)
+	if len(got) != 3 || got[0]["time_period"] != "2024-03" {
+		t.Errorf("trimLeadingEmptyPeriods kept %v, want the periods from 2024-03 on", got)
+	}
+
+	if got := trimLeadingEmptyPeriods(series[:2]); len(got) != 0 {
+		t.Errorf("trimLeadingEmptyPeriods on an empty series kept %d periods, want 0", len(got))
+	}
+}
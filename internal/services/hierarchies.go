@@ -0,0 +1,309 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/prajwalbharadwajbm/backend_assessment/internal/models"
+)
+
+// Hierarchies analytics can roll up and drill down along
+const (
+	// HierarchyLocation is region -> country -> city
+	HierarchyLocation = "location"
+	// HierarchyCategory is category -> subcategory
+	HierarchyCategory = "category"
+)
+
+// hierarchyLevel is one level of a hierarchy and the expression it groups by
+type hierarchyLevel struct {
+	name string
+	expr string
+}
+
+// hierarchy lists the levels from the top down and the joins their expressions need on top of revenueFrom
+type hierarchy struct {
+	levels []hierarchyLevel
+	joins  string
+}
+
+// Sales without a mapping are grouped under a placeholder rather than dropped, so subtotals add up
+var hierarchies = map[string]hierarchy{
+	HierarchyLocation: {
+		levels: []hierarchyLevel{
+			{name: "region", expr: "r.name"},
+			{name: "country", expr: "COALESCE(lh.country, 'Unknown')"},
+			{name: "city", expr: "COALESCE(c.city, 'Unknown')"},
+		},
+		joins: `JOIN regions r ON r.region_id = o.region_id
+			JOIN customers c ON c.customer_id = o.customer_id
+			LEFT JOIN location_hierarchy lh ON lh.region = r.name AND lh.city = c.city`,
+	},
+	HierarchyCategory: {
+		levels: []hierarchyLevel{
+			{name: "category", expr: "p.category"},
+			{name: "subcategory", expr: "COALESCE(ps.subcategory, 'Unspecified')"},
+		},
+		joins: `LEFT JOIN product_subcategories ps ON ps.product_id = p.product_id`,
+	},
+}
+
+// hierarchyMappingColumns are the columns of the mapping file for each hierarchy
+var hierarchyMappingColumns = map[string][]string{
+	HierarchyLocation: {"Region", "Country", "City"},
+	HierarchyCategory: {"Product ID", "Subcategory"},
+}
+
+// addressCity takes the city out of an address formatted as "street, city, state zip"
+// Returns nil when the address doesn't have enough parts to tell
+func addressCity(address string) *string {
+	parts := strings.Split(address, ",")
+	if len(parts) < 3 {
+		return nil
+	}
+
+	city := strings.TrimSpace(parts[len(parts)-2])
+	if city == "" {
+		return nil
+	}
+	return &city
+}
+
+// HierarchyLevels returns the level names of a hierarchy from the top down
+func HierarchyLevels(name string) ([]string, error) {
+	h, ok := hierarchies[name]
+	if !ok {
+		return nil, errors.New("invalid hierarchy: must be 'location' or 'category'")
+	}
+
+	levels := make([]string, len(h.levels))
+	for i, level := range h.levels {
+		levels[i] = level.name
+	}
+	return levels, nil
+}
+
+// LoadHierarchyMapping replaces the mapping of a hierarchy with the contents of a CSV file.
+// Location files have "Region", "Country" and "City" columns, category files "Product ID" and "Subcategory".
+func (dl *DataLoader) LoadHierarchyMapping(ctx context.Context, name, filePath string) (int, error) {
+	columns, ok := hierarchyMappingColumns[name]
+	if !ok {
+		return 0, errors.New("invalid hierarchy: must be 'location' or 'category'")
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open mapping file: %w", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+
+	header, err := reader.Read()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read mapping file header: %w", err)
+	}
+
+	columnMap := make(map[string]int)
+	for i, col := range header {
+		columnMap[col] = i
+	}
+	for _, col := range columns {
+		if _, ok := columnMap[col]; !ok {
+			return 0, fmt.Errorf("column %s not found in mapping file", col)
+		}
+	}
+
+	tx, err := dl.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var clearSQL, insertSQL string
+	switch name {
+	case HierarchyLocation:
+		clearSQL = `DELETE FROM location_hierarchy`
+		insertSQL = `
+			INSERT INTO location_hierarchy (region, country, city)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (region, city) DO UPDATE SET country = $2
+		`
+	case HierarchyCategory:
+		clearSQL = `DELETE FROM product_subcategories`
+		insertSQL = `
+			INSERT INTO product_subcategories (product_id, subcategory)
+			VALUES ($1, $2)
+			ON CONFLICT (product_id) DO UPDATE SET subcategory = $2
+		`
+	}
+
+	if _, err := tx.ExecContext(ctx, clearSQL); err != nil {
+		return 0, fmt.Errorf("failed to clear %s mapping: %w", name, err)
+	}
+
+	insertStmt, err := tx.PrepareContext(ctx, insertSQL)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prepare %s mapping statement: %w", name, err)
+	}
+	defer insertStmt.Close()
+
+	rowsProcessed := 0
+	// The header is line 1
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read mapping file line %d: %w", line, err)
+		}
+
+		values := make([]interface{}, len(columns))
+		for i, col := range columns {
+			value := strings.TrimSpace(record[columnMap[col]])
+			if value == "" {
+				return 0, fmt.Errorf("empty %s on line %d", col, line)
+			}
+			values[i] = value
+		}
+
+		if _, err := insertStmt.ExecContext(ctx, values...); err != nil {
+			return 0, fmt.Errorf("failed to load mapping on line %d: %w", line, err)
+		}
+		rowsProcessed++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	dl.logger.Printf("Loaded %d %s mappings from %s", rowsProcessed, name, filePath)
+	return rowsProcessed, nil
+}
+
+// GetRevenueHierarchy returns revenue and orders along a hierarchy as a tree with subtotals at every level.
+// path drills down by fixing the values of the top levels (e.g. ["Europe", "Germany"]),
+// depth is how many levels below the path to expand, 0 expands all of them.
+// The root node holds the total for everything matching the filter and path.
+func (as *AnalyticsService) GetRevenueHierarchy(ctx context.Context, f models.Filter, name string, path []string, depth int) (map[string]interface{}, error) {
+	h, ok := hierarchies[name]
+	if !ok {
+		return nil, errors.New("invalid hierarchy: must be 'location' or 'category'")
+	}
+	if len(path) >= len(h.levels) {
+		return nil, fmt.Errorf("invalid path: the %s hierarchy has %d levels, the path can fix at most %d", name, len(h.levels), len(h.levels)-1)
+	}
+
+	levels := h.levels
+	if depth > 0 && len(path)+depth < len(levels) {
+		levels = levels[:len(path)+depth]
+	}
+
+	from, err := revenueFrom(f.AsOf)
+	if err != nil {
+		return nil, err
+	}
+	revenueSQL, err := revenueMeasure(f.RevenueBasis)
+	if err != nil {
+		return nil, err
+	}
+
+	qa := &queryArgs{}
+	conditions := filterConditions(f, qa)
+	for i, value := range path {
+		conditions = append(conditions, h.levels[i].expr+" = "+qa.add(value))
+	}
+
+	var selects, groupBy, rolledUp []string
+	for _, level := range levels {
+		selects = append(selects, level.expr)
+		groupBy = append(groupBy, level.expr)
+		rolledUp = append(rolledUp, "GROUPING("+level.expr+")")
+	}
+
+	query := `
+		SELECT
+			` + strings.Join(selects, ", ") + `,
+			` + strings.Join(rolledUp, " + ") + ` as rolled_up,
+			COALESCE(SUM(` + revenueSQL + `), 0) as revenue,
+			COUNT(DISTINCT o.order_id) as orders
+		` + from + `
+		` + h.joins + `
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		GROUP BY ROLLUP(` + strings.Join(groupBy, ", ") + `)
+		ORDER BY rolled_up DESC, revenue DESC
+	`
+
+	rows, err := as.db.QueryContext(ctx, query, qa.values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Rows come with the grand total first and then one level deeper at a time,
+	// so every node's parent already exists when the node is read
+	nodes := make(map[string]map[string]interface{})
+	var root map[string]interface{}
+
+	for rows.Next() {
+		values := make([]sql.NullString, len(levels))
+		var rolled, orders int
+		var revenue float64
+
+		dest := make([]interface{}, 0, len(levels)+3)
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		dest = append(dest, &rolled, &revenue, &orders)
+
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		nodeDepth := len(levels) - rolled
+		node := map[string]interface{}{
+			"revenue": revenue,
+			"orders":  orders,
+		}
+
+		if nodeDepth == 0 {
+			node["level"] = "total"
+			root = node
+			nodes[""] = node
+			continue
+		}
+
+		keyParts := make([]string, nodeDepth)
+		for i := range keyParts {
+			keyParts[i] = values[i].String
+		}
+		level := levels[nodeDepth-1].name
+		node["level"] = level
+		node[level] = values[nodeDepth-1].String
+		nodes[strings.Join(keyParts, "\x00")] = node
+
+		parent := nodes[strings.Join(keyParts[:nodeDepth-1], "\x00")]
+		if parent == nil {
+			continue
+		}
+		children, _ := parent["children"].([]map[string]interface{})
+		parent["children"] = append(children, node)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if root == nil {
+		root = map[string]interface{}{"level": "total", "revenue": 0.0, "orders": 0}
+	}
+
+	return root, nil
+}
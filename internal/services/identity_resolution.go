@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Reasons a customer was linked to another customer
+const (
+	MatchReasonEmail       = "EMAIL"
+	MatchReasonNameAddress = "NAME_ADDRESS"
+)
+
+// normalizeEmail lower cases and trims an email so that casing differences still match.
+// A blank email gives "", which is no key at all and never matches another customer.
+func normalizeEmail(email string) string {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return ""
+	}
+	return strings.ToLower(email)
+}
+
+// nameAddressKey builds the key used to match customers on name and address.
+// Punctuation is dropped and whitespace collapsed, so "123 Main St." and "123  main st" match.
+func nameAddressKey(name, address string) string {
+	normalize := func(s string) string {
+		s = strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r) {
+				return unicode.ToLower(r)
+			}
+			return ' '
+		}, s)
+		return strings.Join(strings.Fields(s), " ")
+	}
+
+	name, address = normalize(name), normalize(address)
+	if name == "" || address == "" {
+		return ""
+	}
+	return name + "|" + address
+}
+
+// resolveCustomerIdentity links a customer to a master customer when another customer ID
+// shares its email or its normalized name and address. Email matches win over name/address matches,
+// and among equal matches the lowest customer ID is taken. The master is always the root of the match,
+// never a customer that is itself linked, and every new link is logged as a conflict.
+// Blank emails and incomplete names or addresses never match.
+// Matching uses the stored customer row rather than the loaded record, since a record older than the
+// customer's latest observation doesn't update it and its stale email or address mustn't link anyone.
+func (dl *DataLoader) resolveCustomerIdentity(ctx context.Context, tx *sql.Tx, logID int, customerID string) error {
+	var email, key string
+	err := tx.QueryRowContext(
+		ctx,
+		`SELECT email, COALESCE(name_address_key, '') FROM customers WHERE customer_id = $1`,
+		customerID,
+	).Scan(&email, &key)
+	if err != nil {
+		return fmt.Errorf("failed to get customer %s for identity resolution: %w", customerID, err)
+	}
+
+	var matchedID, masterID, reason string
+	err = tx.QueryRowContext(
+		ctx,
+		`SELECT customer_id,
+                COALESCE(master_customer_id, customer_id),
+                CASE WHEN $2 <> '' AND LOWER(TRIM(email)) = $2 THEN $4::text ELSE $5::text END
+         FROM customers
+         WHERE customer_id <> $1
+           AND (($2 <> '' AND LOWER(TRIM(email)) = $2) OR ($3 <> '' AND name_address_key = $3))
+         ORDER BY ($2 <> '' AND LOWER(TRIM(email)) = $2) DESC, customer_id
+         LIMIT 1`,
+		customerID,
+		normalizeEmail(email),
+		key,
+		MatchReasonEmail,
+		MatchReasonNameAddress,
+	).Scan(&matchedID, &masterID, &reason)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up matching customers: %w", err)
+	}
+
+	// The matched customer may itself point back at this one, in which case this customer is already the master
+	if masterID == customerID {
+		return nil
+	}
+
+	// Customers that had this one as their master move along with it, so links never form chains
+	// and grouping by COALESCE(master_customer_id, customer_id) keeps one group per person
+	rows, err := tx.QueryContext(
+		ctx,
+		`UPDATE customers SET master_customer_id = $2
+         WHERE (customer_id = $1 AND master_customer_id IS DISTINCT FROM $2)
+            OR master_customer_id = $1
+         RETURNING customer_id`,
+		customerID,
+		masterID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to link customer to master: %w", err)
+	}
+
+	linked, moved := false, 0
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		if id == customerID {
+			linked = true
+		} else {
+			moved++
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to link customer to master: %w", err)
+	}
+
+	if moved > 0 {
+		dl.logger.Printf("Moved %d customers linked to %s over to master customer %s", moved, customerID, masterID)
+	}
+
+	// Only log the first time the link is made, not on every refresh
+	if !linked {
+		return nil
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO customer_identity_conflicts (customer_id, matched_customer_id, master_customer_id, match_reason, log_id)
+         VALUES ($1, $2, $3, $4, $5)`,
+		customerID,
+		matchedID,
+		masterID,
+		reason,
+		logID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to log customer identity conflict: %w", err)
+	}
+
+	dl.logger.Printf("Customer %s matched customer %s on %s, linked to master customer %s", customerID, matchedID, reason, masterID)
+	return nil
+}
@@ -0,0 +1,42 @@
+package services
+
+import "testing"
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Jane.Doe@Example.com", "jane.doe@example.com"},
+		{"  jane@example.com\t", "jane@example.com"},
+		{"", ""},
+		{"   ", ""},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeEmail(tt.in); got != tt.want {
+			t.Errorf("normalizeEmail(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNameAddressKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		want    string
+	}{
+		{"Jane Doe", "123 Main St.", "jane doe|123 main st"},
+		{"  JANE   DOE ", "123  main st", "jane doe|123 main st"},
+		{"O'Brien", "4-B Elm Rd, Apt. 2", "o brien|4 b elm rd apt 2"},
+		{"Jane Doe", "", ""},
+		{"", "123 Main St", ""},
+		{"Jane Doe", "...", ""}, // nothing left once punctuation is dropped
+	}
+
+	for _, tt := range tests {
+		if got := nameAddressKey(tt.name, tt.address); got != tt.want {
+			t.Errorf("nameAddressKey(%q, %q) = %q, want %q", tt.name, tt.address, got, tt.want)
+		}
+	}
+}
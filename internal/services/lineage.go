@@ -0,0 +1,158 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var ErrOrderNotFound = errors.New("order not found")
+
+// recordLineage identifies where a CSV record came from, stored on the orders and order items it loads
+type recordLineage struct {
+	LogID    int
+	SourceID int
+	Line     int
+}
+
+// fileChecksum returns the sha256 of the file and rewinds it so it can be read again
+func fileChecksum(file *os.File) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// registerDataSource records the file being loaded (reusing the row if the same file was loaded before)
+// and links it to the refresh log
+func (dl *DataLoader) registerDataSource(ctx context.Context, tx *sql.Tx, logID int, filePath, checksum string) (int, error) {
+	var sourceID int
+	err := tx.QueryRowContext(
+		ctx,
+		`INSERT INTO data_sources (file_name, file_checksum)
+         VALUES ($1, $2)
+         ON CONFLICT (file_name, file_checksum) DO UPDATE SET file_name = EXCLUDED.file_name
+         RETURNING source_id`,
+		filepath.Base(filePath),
+		checksum,
+	).Scan(&sourceID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to register data source: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE data_refresh_logs SET source_id = $1 WHERE log_id = $2`, sourceID, logID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to link data source to refresh log: %w", err)
+	}
+
+	return sourceID, nil
+}
+
+// GetOrderLineage returns the source file, line and refresh that loaded an order and each of its items
+// Orders loaded before lineage was tracked come back with null lineage fields
+func (as *AnalyticsService) GetOrderLineage(ctx context.Context, orderID string) (map[string]interface{}, error) {
+	var (
+		saleDate     time.Time
+		sourceLine   *int
+		logID        *int
+		sourceID     *int
+		fileName     *string
+		fileChecksum *string
+		triggeredBy  *string
+		loadedAt     *time.Time
+	)
+
+	err := as.db.QueryRowContext(ctx, `
+		SELECT
+			o.sale_date,
+			o.source_line,
+			o.log_id,
+			ds.source_id,
+			ds.file_name,
+			ds.file_checksum,
+			l.triggered_by,
+			l.start_time
+		FROM orders o
+		LEFT JOIN data_sources ds ON o.source_id = ds.source_id
+		LEFT JOIN data_refresh_logs l ON o.log_id = l.log_id
+		WHERE o.order_id = $1
+	`, orderID).Scan(&saleDate, &sourceLine, &logID, &sourceID, &fileName, &fileChecksum, &triggeredBy, &loadedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := as.db.QueryContext(ctx, `
+		SELECT
+			oi.order_item_id,
+			oi.product_id,
+			oi.source_line,
+			oi.log_id,
+			ds.source_id,
+			ds.file_name,
+			ds.file_checksum
+		FROM order_items oi
+		LEFT JOIN data_sources ds ON oi.source_id = ds.source_id
+		WHERE oi.order_id = $1
+		ORDER BY oi.order_item_id
+	`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []map[string]interface{}{}
+
+	for rows.Next() {
+		var orderItemID int
+		var productID string
+		var itemLine, itemLogID, itemSourceID *int
+		var itemFileName, itemChecksum *string
+
+		if err := rows.Scan(&orderItemID, &productID, &itemLine, &itemLogID, &itemSourceID, &itemFileName, &itemChecksum); err != nil {
+			return nil, err
+		}
+
+		items = append(items, map[string]interface{}{
+			"order_item_id": orderItemID,
+			"product_id":    productID,
+			"source_id":     itemSourceID,
+			"file_name":     itemFileName,
+			"file_checksum": itemChecksum,
+			"source_line":   itemLine,
+			"log_id":        itemLogID,
+		})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"order_id":      orderID,
+		"sale_date":     saleDate.Format("2006-01-02"),
+		"source_id":     sourceID,
+		"file_name":     fileName,
+		"file_checksum": fileChecksum,
+		"source_line":   sourceLine,
+		"log_id":        logID,
+		"triggered_by":  triggeredBy,
+		"loaded_at":     loadedAt,
+		"items":         items,
+	}, nil
+}
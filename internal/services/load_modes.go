@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Load modes for RefreshData. Every mode runs in the refresh transaction,
+// so analytics never see a half replaced dataset.
+const (
+	// LoadModeAppend only inserts orders and order items that aren't loaded yet
+	LoadModeAppend = "append"
+	// LoadModeUpsert inserts new rows and overwrites existing ones with the values from the file
+	LoadModeUpsert = "upsert"
+	// LoadModeFullReplace deletes every order before loading the file
+	LoadModeFullReplace = "full_replace"
+	// LoadModePartitionReplace deletes the orders in the date range covered by the file, and the items of
+	// every order in the file, before loading it
+	LoadModePartitionReplace = "partition_replace"
+)
+
+// ValidateLoadMode checks a load mode, an empty mode falls back to upsert
+func ValidateLoadMode(mode string) (string, error) {
+	switch mode {
+	case "":
+		return LoadModeUpsert, nil
+	case LoadModeAppend, LoadModeUpsert, LoadModeFullReplace, LoadModePartitionReplace:
+		return mode, nil
+	default:
+		return "", errors.New("invalid load_mode: must be 'append', 'upsert', 'full_replace' or 'partition_replace'")
+	}
+}
+
+// orderInsertSQL returns the order insert for the load mode, append keeps existing orders as they are
+func orderInsertSQL(mode string) string {
+	insert := `
+		INSERT INTO orders (order_id, customer_id, region_id, sale_date, shipping_cost, payment_method_id, source_id, source_line, log_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+	if mode == LoadModeAppend {
+		return insert + `ON CONFLICT (order_id) DO NOTHING`
+	}
+
+	return insert + `
+		ON CONFLICT (order_id) DO UPDATE
+		SET customer_id = $2, region_id = $3, sale_date = $4, shipping_cost = $5, payment_method_id = $6,
+			source_id = $7, source_line = $8, log_id = $9
+	`
+}
+
+// orderItemInsertSQL returns the order item insert for the load mode, keyed on order and product.
+// A file may only have one line per product in an order, processRecord rejects repeats.
+func orderItemInsertSQL(mode string) string {
+	insert := `
+		INSERT INTO order_items (order_id, product_id, quantity, unit_price, discount, source_id, source_line, log_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	if mode == LoadModeAppend {
+		return insert + `ON CONFLICT (order_id, product_id) DO NOTHING`
+	}
+
+	return insert + `
+		ON CONFLICT (order_id, product_id) DO UPDATE
+		SET quantity = $3, unit_price = $4, discount = $5, source_id = $6, source_line = $7, log_id = $8
+	`
+}
+
+// clearForLoad deletes the orders a replace mode is about to reload, along with the product and customer
+// observations of their sales, inside the refresh transaction
+func (dl *DataLoader) clearForLoad(ctx context.Context, tx *sql.Tx, mode string, file *os.File) error {
+	switch mode {
+	case LoadModeFullReplace:
+		if _, err := tx.ExecContext(ctx, `DELETE FROM order_items`); err != nil {
+			return fmt.Errorf("failed to delete order items: %w", err)
+		}
+		result, err := tx.ExecContext(ctx, `DELETE FROM orders`)
+		if err != nil {
+			return fmt.Errorf("failed to delete orders: %w", err)
+		}
+
+		if err := clearAllObservations(ctx, tx); err != nil {
+			return err
+		}
+
+		deleted, _ := result.RowsAffected()
+		dl.logger.Printf("Full replace: deleted %d orders", deleted)
+
+	case LoadModePartitionReplace:
+		from, to, orderIDs, err := scanLoadFile(file)
+		if err != nil {
+			return err
+		}
+		// Empty file, nothing to replace
+		if from.IsZero() {
+			return nil
+		}
+
+		// Orders in the file whose stored date lies outside its range (a corrected sale date) are upserted,
+		// their items are cleared too so lines removed from the order don't survive
+		_, err = tx.ExecContext(ctx, `
+			DELETE FROM order_items
+			WHERE order_id IN (SELECT order_id FROM orders WHERE sale_date BETWEEN $1 AND $2)
+			   OR order_id = ANY($3)
+		`, from, to, pq.Array(orderIDs))
+		if err != nil {
+			return fmt.Errorf("failed to delete order items in range: %w", err)
+		}
+		result, err := tx.ExecContext(ctx, `DELETE FROM orders WHERE sale_date BETWEEN $1 AND $2`, from, to)
+		if err != nil {
+			return fmt.Errorf("failed to delete orders in range: %w", err)
+		}
+		if err := clearObservations(ctx, tx, from, to); err != nil {
+			return err
+		}
+
+		deleted, _ := result.RowsAffected()
+		dl.logger.Printf("Partition replace: deleted %d orders between %s and %s", deleted, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	}
+
+	return nil
+}
+
+// scanLoadFile scans the file for the earliest and latest sale dates and the order IDs in it, and rewinds it
+// Returns zero times if the file has no records
+func scanLoadFile(file *os.File) (time.Time, time.Time, []string, error) {
+	var from, to time.Time
+	var orderIDs []string
+	seen := make(map[string]struct{})
+
+	reader := csv.NewReader(file)
+
+	header, err := reader.Read()
+	if err != nil {
+		return from, to, nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	dateIdx, orderIdx := -1, -1
+	for i, col := range header {
+		switch col {
+		case "Date of Sale":
+			dateIdx = i
+		case "Order ID":
+			orderIdx = i
+		}
+	}
+	if dateIdx == -1 {
+		return from, to, nil, fmt.Errorf("column Date of Sale not found in CSV")
+	}
+	if orderIdx == -1 {
+		return from, to, nil, fmt.Errorf("column Order ID not found in CSV")
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return from, to, nil, fmt.Errorf("error reading CSV record: %w", err)
+		}
+		if dateIdx >= len(record) || orderIdx >= len(record) {
+			return from, to, nil, fmt.Errorf("record has fewer columns than expected")
+		}
+
+		saleDate, err := time.Parse("2006-01-02", record[dateIdx])
+		if err != nil {
+			return from, to, nil, fmt.Errorf("invalid date format: %w", err)
+		}
+
+		if _, ok := seen[record[orderIdx]]; !ok {
+			seen[record[orderIdx]] = struct{}{}
+			orderIDs = append(orderIDs, record[orderIdx])
+		}
+
+		if from.IsZero() || saleDate.Before(from) {
+			from = saleDate
+		}
+		if saleDate.After(to) {
+			to = saleDate
+		}
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return from, to, nil, err
+	}
+
+	return from, to, orderIDs, nil
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestValidateLoadMode(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"", LoadModeUpsert, false},
+		{LoadModeAppend, LoadModeAppend, false},
+		{LoadModeUpsert, LoadModeUpsert, false},
+		{LoadModeFullReplace, LoadModeFullReplace, false},
+		{LoadModePartitionReplace, LoadModePartitionReplace, false},
+		{"APPEND", "", true},
+		{"replace", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ValidateLoadMode(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ValidateLoadMode(%q) = %q, %v, want %q, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestScanLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sales.csv")
+	csv := "Order ID,Product ID,Date of Sale\n" +
+		"O2,P1,2024-03-10\n" +
+		"O1,P1,2024-01-05\n" +
+		"O2,P2,2024-03-10\n" +
+		"O3,P1,2024-02-20\n"
+	if err := os.WriteFile(path, []byte(csv), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	from, to, orderIDs, err := scanLoadFile(file)
+	if err != nil {
+		t.Fatalf("scanLoadFile: %v", err)
+	}
+	if !from.Equal(date("2024-01-05")) || !to.Equal(date("2024-03-10")) {
+		t.Errorf("range = %s to %s, want 2024-01-05 to 2024-03-10", from.Format("2006-01-02"), to.Format("2006-01-02"))
+	}
+	if want := []string{"O2", "O1", "O3"}; !reflect.DeepEqual(orderIDs, want) {
+		t.Errorf("orderIDs = %v, want %v", orderIDs, want)
+	}
+
+	// The file is rewound for the load that follows
+	if offset, _ := file.Seek(0, io.SeekCurrent); offset != 0 {
+		t.Errorf("file offset = %d after scanning, want 0", offset)
+	}
+}
+
+func TestSeenItem(t *testing.T) {
+	ct := newControlTotals()
+
+	if _, dup := ct.seenItem("O1", "P1", 2); dup {
+		t.Error("first O1/P1 reported as a repeat")
+	}
+	if _, dup := ct.seenItem("O1", "P2", 3); dup {
+		t.Error("O1/P2 reported as a repeat")
+	}
+	if _, dup := ct.seenItem("O2", "P1", 4); dup {
+		t.Error("O2/P1 reported as a repeat")
+	}
+	if first, dup := ct.seenItem("O1", "P1", 5); !dup || first != 2 {
+		t.Errorf("second O1/P1 = line %d, repeat %v, want line 2, repeat true", first, dup)
+	}
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/prajwalbharadwajbm/backend_assessment/internal/models"
+)
+
+// GetProductAffinity finds products that are frequently bought together in the same order.
+// For each pair it returns:
+//   - support: share of orders containing both products
+//   - confidence: share of orders with one product that also contain the other, in both directions
+//   - lift: how much more often the pair occurs than if the products were bought independently
+//
+// Products below minSupport on their own can't reach it as a pair, so they are pruned before pairing,
+// which keeps the self join small on large datasets.
+func (as *AnalyticsService) GetProductAffinity(ctx context.Context, f models.Filter, minSupport float64) ([]map[string]interface{}, error) {
+	if minSupport <= 0 || minSupport > 1 {
+		return nil, errors.New("invalid min_support: must be greater than 0 and at most 1")
+	}
+
+	from, err := revenueFrom(f.AsOf)
+	if err != nil {
+		return nil, err
+	}
+
+	qa := &queryArgs{}
+	where := whereClause(f, qa)
+	support := qa.add(minSupport)
+
+	query := `
+		WITH baskets AS (
+			SELECT DISTINCT oi.order_id, oi.product_id
+			` + from + `
+			` + where + `
+		),
+		order_count AS (
+			SELECT COUNT(DISTINCT order_id)::float as total FROM baskets
+		),
+		frequent_products AS (
+			SELECT product_id, COUNT(*) as orders
+			FROM baskets
+			GROUP BY product_id
+			HAVING COUNT(*) / (SELECT total FROM order_count) >= ` + support + `
+		),
+		pairs AS (
+			SELECT a.product_id as product_a, b.product_id as product_b, COUNT(*) as orders
+			FROM baskets a
+			JOIN baskets b ON a.order_id = b.order_id AND a.product_id < b.product_id
+			WHERE a.product_id IN (SELECT product_id FROM frequent_products)
+			  AND b.product_id IN (SELECT product_id FROM frequent_products)
+			GROUP BY a.product_id, b.product_id
+			HAVING COUNT(*) / (SELECT total FROM order_count) >= ` + support + `
+		)
+		SELECT
+			pr.product_a,
+			pa.name,
+			pr.product_b,
+			pb.name,
+			pr.orders,
+			pr.orders / oc.total as support,
+			pr.orders::float / fa.orders as confidence_a_to_b,
+			pr.orders::float / fb.orders as confidence_b_to_a,
+			(pr.orders * oc.total) / (fa.orders * fb.orders) as lift
+		FROM pairs pr
+		CROSS JOIN order_count oc
+		JOIN frequent_products fa ON fa.product_id = pr.product_a
+		JOIN frequent_products fb ON fb.product_id = pr.product_b
+		JOIN products pa ON pa.product_id = pr.product_a
+		JOIN products pb ON pb.product_id = pr.product_b
+		ORDER BY lift DESC, support DESC
+		` + limitClause(f, qa) + `
+	`
+
+	rows, err := as.db.QueryContext(ctx, query, qa.values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []map[string]interface{}
+
+	for rows.Next() {
+		var productA, nameA, productB, nameB string
+		var orders int
+		var pairSupport, confidenceAB, confidenceBA, lift float64
+
+		if err := rows.Scan(&productA, &nameA, &productB, &nameB, &orders, &pairSupport, &confidenceAB, &confidenceBA, &lift); err != nil {
+			return nil, err
+		}
+
+		results = append(results, map[string]interface{}{
+			"product_a":         productA,
+			"product_a_name":    nameA,
+			"product_b":         productB,
+			"product_b_name":    nameB,
+			"orders":            orders,
+			"support":           pairSupport,
+			"confidence_a_to_b": confidenceAB,
+			"confidence_b_to_a": confidenceBA,
+			"lift":              lift,
+		})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/prajwalbharadwajbm/backend_assessment/internal/models"
+)
+
+// firstOrdersCTE flags every order placed on its customer's first purchase day across all history,
+// regardless of any filter, so several orders on that first day all count as new.
+// Linked customer IDs count as their master customer, so a merged account's second ID isn't a new customer.
+const firstOrdersCTE = `first_orders AS (
+	SELECT
+		o.order_id,
+		o.sale_date = MIN(o.sale_date) OVER (PARTITION BY COALESCE(c.master_customer_id, c.customer_id)) as is_new
+	FROM orders o
+	JOIN customers c ON o.customer_id = c.customer_id
+)`
+
+// GetNewVsReturningRevenue splits revenue, orders and average order value between orders from new customers
+// (placed on their first purchase day) and returning customers, by time period or region.
+// The time breakdown fills periods without sales with zeros.
+func (as *AnalyticsService) GetNewVsReturningRevenue(ctx context.Context, f models.Filter, breakdown, interval string) ([]map[string]interface{}, error) {
+	unit, timeFormat, err := timeBucket(interval)
+	if err != nil {
+		return nil, err
+	}
+
+	var group string
+	switch breakdown {
+	case "time":
+		group = "TO_CHAR(DATE_TRUNC('" + unit + "', o.sale_date), '" + timeFormat + "')"
+	case "region":
+		group = "r.name"
+	default:
+		return nil, errors.New("invalid breakdown: must be 'time' or 'region'")
+	}
+
+	from, err := revenueFrom(f.AsOf)
+	if err != nil {
+		return nil, err
+	}
+	revenueSQL, err := revenueMeasure(f.RevenueBasis)
+	if err != nil {
+		return nil, err
+	}
+
+	qa := &queryArgs{}
+	query := `
+		WITH ` + firstOrdersCTE + `
+		SELECT
+			` + group + ` as grp,
+			fo.is_new,
+			COALESCE(SUM(` + revenueSQL + `), 0) as revenue,
+			COUNT(DISTINCT o.order_id) as orders,
+			COUNT(DISTINCT COALESCE(c.master_customer_id, c.customer_id)) as customers
+		` + from + `
+		JOIN first_orders fo ON fo.order_id = o.order_id
+		JOIN customers c ON c.customer_id = o.customer_id
+		JOIN regions r ON r.region_id = o.region_id
+		` + whereClause(f, qa) + `
+		GROUP BY 1, 2
+		ORDER BY 1
+	`
+
+	rows, err := as.db.QueryContext(ctx, query, qa.values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []string
+	splits := make(map[string]map[bool]map[string]interface{})
+
+	for rows.Next() {
+		var name string
+		var isNew bool
+		var revenue float64
+		var orders, customers int
+
+		if err := rows.Scan(&name, &isNew, &revenue, &orders, &customers); err != nil {
+			return nil, err
+		}
+
+		if splits[name] == nil {
+			splits[name] = make(map[bool]map[string]interface{})
+			groups = append(groups, name)
+		}
+		splits[name][isNew] = map[string]interface{}{
+			"revenue":             revenue,
+			"orders":              orders,
+			"customers":           customers,
+			"average_order_value": revenue / float64(orders),
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if breakdown == "time" {
+		periods, err := as.periodLabels(ctx, f, unit, timeFormat)
+		if err != nil {
+			return nil, err
+		}
+		groups = periods
+	}
+
+	empty := map[string]interface{}{"revenue": 0.0, "orders": 0, "customers": 0, "average_order_value": 0.0}
+
+	results := make([]map[string]interface{}, 0, len(groups))
+	for _, name := range groups {
+		newSplit, returningSplit := empty, empty
+		if split, ok := splits[name][true]; ok {
+			newSplit = split
+		}
+		if split, ok := splits[name][false]; ok {
+			returningSplit = split
+		}
+
+		key := "region"
+		if breakdown == "time" {
+			key = "time_period"
+		}
+
+		row := map[string]interface{}{
+			key:                 name,
+			"new":               newSplit,
+			"returning":         returningSplit,
+			"new_revenue_share": 0.0,
+		}
+		if total := newSplit["revenue"].(float64) + returningSplit["revenue"].(float64); total != 0 {
+			row["new_revenue_share"] = newSplit["revenue"].(float64) / total
+		}
+
+		results = append(results, row)
+	}
+
+	return results, nil
+}
+
+// periodLabels lists every period of the DATE_TRUNC unit in the filter's date range, formatted like TO_CHAR(timeFormat)
+func (as *AnalyticsService) periodLabels(ctx context.Context, f models.Filter, unit, timeFormat string) ([]string, error) {
+	rows, err := as.db.QueryContext(ctx, `
+		SELECT TO_CHAR(GENERATE_SERIES(
+			DATE_TRUNC('`+unit+`', $1::date),
+			DATE_TRUNC('`+unit+`', $2::date),
+			'`+bucketStep(unit)+`'::interval
+		), '`+timeFormat+`')
+	`, f.StartDate, f.EndDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var periods []string
+	for rows.Next() {
+		var period string
+		if err := rows.Scan(&period); err != nil {
+			return nil, err
+		}
+		periods = append(periods, period)
+	}
+
+	return periods, rows.Err()
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"context"
+
+	"github.com/prajwalbharadwajbm/backend_assessment/internal/models"
+)
+
+// GetPaymentMixOverTime returns, for every period and region, the revenue and orders of each payment method
+// and its share of the region's revenue and orders in that period, so shifts in how customers pay show up as trends
+func (as *AnalyticsService) GetPaymentMixOverTime(ctx context.Context, f models.Filter, interval string) ([]map[string]interface{}, error) {
+	unit, timeFormat, err := timeBucket(interval)
+	if err != nil {
+		return nil, err
+	}
+
+	from, err := revenueFrom(f.AsOf)
+	if err != nil {
+		return nil, err
+	}
+	revenueSQL, err := revenueMeasure(f.RevenueBasis)
+	if err != nil {
+		return nil, err
+	}
+
+	qa := &queryArgs{}
+	query := `
+		WITH mix AS (
+			SELECT
+				DATE_TRUNC('` + unit + `', o.sale_date) as period,
+				r.name as region,
+				pm.name as payment_method,
+				COALESCE(SUM(` + revenueSQL + `), 0) as revenue,
+				COUNT(DISTINCT o.order_id) as orders
+			` + from + `
+			JOIN regions r ON r.region_id = o.region_id
+			JOIN payment_methods pm ON pm.payment_method_id = o.payment_method_id
+			` + whereClause(f, qa) + `
+			GROUP BY 1, 2, 3
+		)
+		SELECT
+			TO_CHAR(period, '` + timeFormat + `') as time_period,
+			region,
+			payment_method,
+			revenue,
+			orders,
+			COALESCE(revenue / NULLIF(SUM(revenue) OVER (PARTITION BY period, region), 0), 0) as revenue_share,
+			orders::float / SUM(orders) OVER (PARTITION BY period, region) as order_share
+		FROM mix
+		ORDER BY period, region, revenue DESC
+	`
+
+	rows, err := as.db.QueryContext(ctx, query, qa.values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []map[string]interface{}
+
+	for rows.Next() {
+		var timePeriod, region, paymentMethod string
+		var revenue, revenueShare, orderShare float64
+		var orders int
+
+		if err := rows.Scan(&timePeriod, &region, &paymentMethod, &revenue, &orders, &revenueShare, &orderShare); err != nil {
+			return nil, err
+		}
+
+		results = append(results, map[string]interface{}{
+			"time_period":    timePeriod,
+			"region":         region,
+			"payment_method": paymentMethod,
+			"revenue":        revenue,
+			"orders":         orders,
+			"revenue_share":  revenueShare,
+			"order_share":    orderShare,
+		})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/prajwalbharadwajbm/backend_assessment/internal/models"
+)
+
+// Normalizations for pivot cells, each turns values into percentages
+const (
+	// PivotNormalizeTotal divides every cell by the grand total
+	PivotNormalizeTotal = "total"
+	// PivotNormalizeRow divides every cell by its row total
+	PivotNormalizeRow = "row"
+	// PivotNormalizeColumn divides every cell by its column total
+	PivotNormalizeColumn = "column"
+)
+
+// pivotKey is the column a dimension is keyed on in a pivot, the ID for dimensions that return an ID and a name.
+// label is the name column for those dimensions (product_name, customer_name) and empty for the others.
+func pivotKey(dimension, timeGrain string) (key, label string, err error) {
+	columns, err := dimensionColumns(dimension, timeGrain)
+	if err != nil {
+		return "", "", err
+	}
+	if len(columns) > 1 {
+		label = columns[1].alias
+	}
+	return columns[0].alias, label, nil
+}
+
+// measureValue reads a measure from a query row as a float, integer measures come back as int64
+func measureValue(row map[string]interface{}, measure string) float64 {
+	switch v := row[measure].(type) {
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	default:
+		return 0
+	}
+}
+
+// percentOf returns value as a percentage of total, zero when the total is zero
+func percentOf(value, total float64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return value / total * 100
+}
+
+// RunPivot cross-tabulates a measure over two dimensions using the generic query compiler.
+// Row, column and grand totals are queried separately rather than summed from the cells,
+// so they stay correct for measures that don't add up, such as distinct orders.
+// Rows are ordered by their total, largest first, and columns by theirs, except time which stays chronological.
+func (as *AnalyticsService) RunPivot(ctx context.Context, q models.PivotQuery) (map[string]interface{}, error) {
+	if q.Rows == q.Columns {
+		return nil, fmt.Errorf("%w: rows and columns must be different dimensions", ErrInvalidQuery)
+	}
+
+	measure, ok := queryMeasures[q.Measure]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown measure %q, must be one of %s", ErrInvalidQuery, q.Measure, strings.Join(queryMeasureNames(), ", "))
+	}
+
+	switch q.Normalize {
+	case "":
+	case PivotNormalizeTotal, PivotNormalizeRow, PivotNormalizeColumn:
+		if measure.ratio {
+			return nil, fmt.Errorf("%w: %s can't be normalized, it isn't a total", ErrInvalidQuery, q.Measure)
+		}
+	default:
+		return nil, fmt.Errorf("%w: normalize must be 'total', 'row' or 'column'", ErrInvalidQuery)
+	}
+
+	rowKey, rowLabel, err := pivotKey(q.Rows, q.TimeGrain)
+	if err != nil {
+		return nil, err
+	}
+	columnKey, columnLabel, err := pivotKey(q.Columns, q.TimeGrain)
+	if err != nil {
+		return nil, err
+	}
+
+	run := func(dimensions ...string) ([]map[string]interface{}, error) {
+		return as.RunQuery(ctx, models.AnalyticsQuery{
+			Dimensions: dimensions,
+			Measures:   []string{q.Measure},
+			TimeGrain:  q.TimeGrain,
+			Filters:    q.Filters,
+		})
+	}
+
+	cells, err := run(q.Rows, q.Columns)
+	if err != nil {
+		return nil, err
+	}
+	if len(cells) >= maxQueryRows {
+		return nil, fmt.Errorf("%w: the pivot has more than %d cells, narrow the filters", ErrInvalidQuery, maxQueryRows)
+	}
+
+	rowTotals, err := run(q.Rows)
+	if err != nil {
+		return nil, err
+	}
+	columnTotals, err := run(q.Columns)
+	if err != nil {
+		return nil, err
+	}
+	grand, err := run()
+	if err != nil {
+		return nil, err
+	}
+
+	var grandTotal float64
+	if len(grand) > 0 {
+		grandTotal = measureValue(grand[0], q.Measure)
+	}
+
+	// Totals come back ordered by the measure, time is put back in order
+	if q.Rows == "time" {
+		sort.Slice(rowTotals, func(i, j int) bool {
+			return rowTotals[i][rowKey].(string) < rowTotals[j][rowKey].(string)
+		})
+	}
+	if q.Columns == "time" {
+		sort.Slice(columnTotals, func(i, j int) bool {
+			return columnTotals[i][columnKey].(string) < columnTotals[j][columnKey].(string)
+		})
+	}
+
+	columnKeys := make([]string, 0, len(columnTotals))
+	columnTotal := make(map[string]float64, len(columnTotals))
+	columnLabels := make(map[string]interface{})
+	for _, row := range columnTotals {
+		key := row[columnKey].(string)
+		columnKeys = append(columnKeys, key)
+		columnTotal[key] = measureValue(row, q.Measure)
+		if columnLabel != "" {
+			columnLabels[key] = row[columnLabel]
+		}
+	}
+
+	values := make(map[string]map[string]float64, len(rowTotals))
+	for _, cell := range cells {
+		row := cell[rowKey].(string)
+		if values[row] == nil {
+			values[row] = make(map[string]float64)
+		}
+		values[row][cell[columnKey].(string)] = measureValue(cell, q.Measure)
+	}
+
+	data := make([]map[string]interface{}, 0, len(rowTotals))
+	for _, totalRow := range rowTotals {
+		key := totalRow[rowKey].(string)
+		total := measureValue(totalRow, q.Measure)
+
+		rowCells := make(map[string]float64, len(columnKeys))
+		for _, column := range columnKeys {
+			value := values[key][column]
+			switch q.Normalize {
+			case PivotNormalizeTotal:
+				value = percentOf(value, grandTotal)
+			case PivotNormalizeRow:
+				value = percentOf(value, total)
+			case PivotNormalizeColumn:
+				value = percentOf(value, columnTotal[column])
+			}
+			rowCells[column] = value
+		}
+
+		row := map[string]interface{}{
+			rowKey:  key,
+			"cells": rowCells,
+			"total": total,
+		}
+		if rowLabel != "" {
+			row[rowLabel] = totalRow[rowLabel]
+		}
+		if q.Normalize != "" {
+			row["total"] = percentOf(total, grandTotal)
+		}
+		data = append(data, row)
+	}
+
+	if q.Normalize != "" {
+		for column, total := range columnTotal {
+			columnTotal[column] = percentOf(total, grandTotal)
+		}
+	}
+
+	pivot := map[string]interface{}{
+		"row_key":       rowKey,
+		"column_key":    columnKey,
+		"columns":       columnKeys,
+		"data":          data,
+		"column_totals": columnTotal,
+		"grand_total":   grandTotal,
+	}
+	// Product and customer columns are keyed by ID, their names come alongside
+	if columnLabel != "" {
+		pivot["column_labels"] = columnLabels
+	}
+
+	return pivot, nil
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/prajwalbharadwajbm/backend_assessment/internal/models"
+)
+
+// cogsExpr is the cost of goods sold for a single order item, at the product cost in effect on the sale date
+// Items sold before the product's first known cost count at zero cost, see uncostedExpr
+const cogsExpr = `(oi.quantity * COALESCE((
+	SELECT pc.unit_cost FROM product_costs pc
+	WHERE pc.product_id = oi.product_id AND pc.effective_from <= o.sale_date
+	ORDER BY pc.effective_from DESC LIMIT 1
+), 0))`
+
+// uncostedExpr is true for order items without a product cost on their sale date
+const uncostedExpr = `NOT EXISTS (
+	SELECT 1 FROM product_costs pc
+	WHERE pc.product_id = oi.product_id AND pc.effective_from <= o.sale_date
+)`
+
+// Groupings for margin reporting, rows are grouped by the first column and the second is the display name
+var marginGroups = map[string][2]string{
+	"product":  {"p.product_id", latestProductAttribute("p.name")},
+	"category": {"p.category", "p.category"},
+	"region":   {"r.name", "r.name"},
+}
+
+// LoadProductCosts loads product unit costs from a CSV file with the columns
+// "Product ID", "Unit Cost" and "Effective Date". A cost applies to sales from its effective date
+// until the next cost of the same product, loading a cost for an existing date overwrites it.
+// The file is loaded in a single transaction and products must already exist.
+func (dl *DataLoader) LoadProductCosts(ctx context.Context, filePath string) (int, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open cost file: %w", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+
+	header, err := reader.Read()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read cost file header: %w", err)
+	}
+
+	columnMap := make(map[string]int)
+	for i, col := range header {
+		columnMap[col] = i
+	}
+	for _, col := range []string{"Product ID", "Unit Cost", "Effective Date"} {
+		if _, ok := columnMap[col]; !ok {
+			return 0, fmt.Errorf("column %s not found in cost file", col)
+		}
+	}
+
+	tx, err := dl.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	costStmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO product_costs (product_id, unit_cost, effective_from)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (product_id, effective_from) DO UPDATE
+		SET unit_cost = $2, loaded_at = NOW()
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prepare product cost statement: %w", err)
+	}
+	defer costStmt.Close()
+
+	rowsProcessed := 0
+	// The header is line 1
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read cost file line %d: %w", line, err)
+		}
+
+		productID := record[columnMap["Product ID"]]
+
+		unitCost, err := strconv.ParseFloat(record[columnMap["Unit Cost"]], 64)
+		if err != nil || unitCost < 0 {
+			return 0, fmt.Errorf("invalid unit cost on line %d", line)
+		}
+
+		effectiveFrom, err := time.Parse("2006-01-02", record[columnMap["Effective Date"]])
+		if err != nil {
+			return 0, fmt.Errorf("invalid effective date on line %d: %w", line, err)
+		}
+
+		if _, err := costStmt.ExecContext(ctx, productID, unitCost, effectiveFrom); err != nil {
+			return 0, fmt.Errorf("failed to load cost for product %s on line %d: %w", productID, line, err)
+		}
+		rowsProcessed++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	dl.logger.Printf("Loaded %d product costs from %s", rowsProcessed, filePath)
+	return rowsProcessed, nil
+}
+
+// GetGrossMargin returns revenue, cost of goods sold, gross margin and margin % by product, category or region.
+// Revenue follows f.RevenueBasis, so net_of_shipping gives the margin after shipping.
+// uncosted_revenue is the revenue of items sold without a known product cost, which count at zero cost.
+func (as *AnalyticsService) GetGrossMargin(ctx context.Context, f models.Filter, groupBy string) ([]map[string]interface{}, error) {
+	group, ok := marginGroups[groupBy]
+	if !ok {
+		return nil, errors.New("invalid group_by: must be 'product', 'category' or 'region'")
+	}
+
+	from, err := revenueFrom(f.AsOf)
+	if err != nil {
+		return nil, err
+	}
+	revenueSQL, err := revenueMeasure(f.RevenueBasis)
+	if err != nil {
+		return nil, err
+	}
+
+	qa := &queryArgs{}
+	query := `
+		SELECT
+			` + group[0] + `,
+			` + group[1] + `,
+			COALESCE(SUM(` + revenueSQL + `), 0) as revenue,
+			COALESCE(SUM(` + cogsExpr + `), 0) as cogs,
+			COALESCE(SUM(` + revenueSQL + `) FILTER (WHERE ` + uncostedExpr + `), 0) as uncosted_revenue
+		` + from + `
+		JOIN regions r ON r.region_id = o.region_id
+		` + whereClause(f, qa) + `
+		GROUP BY ` + group[0] + `
+		ORDER BY revenue - cogs DESC
+		` + limitClause(f, qa) + `
+	`
+
+	rows, err := as.db.QueryContext(ctx, query, qa.values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []map[string]interface{}
+
+	for rows.Next() {
+		var key, name string
+		var revenue, cogs, uncostedRevenue float64
+
+		if err := rows.Scan(&key, &name, &revenue, &cogs, &uncostedRevenue); err != nil {
+			return nil, err
+		}
+
+		var marginPct *float64
+		if revenue != 0 {
+			pct := (revenue - cogs) / revenue * 100
+			marginPct = &pct
+		}
+
+		row := map[string]interface{}{
+			groupBy:            key,
+			"revenue":          revenue,
+			"cogs":             cogs,
+			"gross_margin":     revenue - cogs,
+			"margin_pct":       marginPct,
+			"uncosted_revenue": uncostedRevenue,
+		}
+		if groupBy == "product" {
+			row["name"] = name
+		}
+
+		results = append(results, row)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
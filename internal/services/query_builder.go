@@ -0,0 +1,280 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/prajwalbharadwajbm/backend_assessment/internal/models"
+)
+
+// ErrInvalidQuery is returned for queries that ask for unknown dimensions, measures or sort fields
+var ErrInvalidQuery = errors.New("invalid query")
+
+// maxQueryRows caps the rows a generic query can return when no smaller limit is given
+const maxQueryRows = 10000
+
+// queryColumn is a selected SQL expression and the key it is returned under
+// Aggregate columns describe their group rather than define it, so they aren't grouped by
+type queryColumn struct {
+	alias     string
+	expr      string
+	aggregate bool
+}
+
+// queryDimension is something a query can group by, some dimensions return more than one column (id and name)
+type queryDimension struct {
+	columns []queryColumn
+}
+
+// queryMeasure is an aggregate a query can compute, integer measures are returned as whole numbers
+// Ratio measures such as averages can't be added up across groups
+type queryMeasure struct {
+	expr    string
+	integer bool
+	ratio   bool
+}
+
+// queryDimensions are the dimensions a generic query can group by, all expressions use the aliases from queryFrom
+// "time" is bucketed by the query's time grain
+var queryDimensions = map[string]queryDimension{
+	"product": {columns: []queryColumn{
+		{alias: "product_id", expr: "p.product_id"},
+		{alias: "product_name", expr: latestProductAttribute("p.name"), aggregate: true},
+	}},
+	"category": {columns: []queryColumn{
+		{alias: "category", expr: "p.category"},
+	}},
+	"region": {columns: []queryColumn{
+		{alias: "region", expr: "r.name"},
+	}},
+	"payment_method": {columns: []queryColumn{
+		{alias: "payment_method", expr: "pm.name"},
+	}},
+	"customer": {columns: []queryColumn{
+		{alias: "customer_id", expr: "c.customer_id"},
+		{alias: "customer_name", expr: "c.name"},
+	}},
+}
+
+// revenueToken stands for the item revenue in measure expressions, it is replaced by the query's revenue definition
+const revenueToken = "{revenue}"
+
+// queryMeasures are the aggregates a generic query can compute
+var queryMeasures = map[string]queryMeasure{
+	"revenue":      {expr: "COALESCE(SUM(" + revenueToken + "), 0)"},
+	"cogs":         {expr: "COALESCE(SUM(" + cogsExpr + "), 0)"},
+	"gross_margin": {expr: "COALESCE(SUM(" + revenueToken + " - " + cogsExpr + "), 0)"},
+	"margin_pct":   {expr: "COALESCE(SUM(" + revenueToken + " - " + cogsExpr + ") / NULLIF(SUM(" + revenueToken + "), 0) * 100, 0)", ratio: true},
+	"units":        {expr: "COALESCE(SUM(oi.quantity), 0)", integer: true},
+	"orders":       {expr: "COUNT(DISTINCT o.order_id)", integer: true},
+	"avg_discount": {expr: "COALESCE(AVG(oi.discount), 0)", ratio: true},
+	"shipping":     {expr: "COALESCE(SUM(" + shippingShareExpr + "), 0)"},
+}
+
+// queryFrom joins everything the generic query dimensions can refer to
+func queryFrom(asOf string) (string, error) {
+	from, err := revenueFrom(asOf)
+	if err != nil {
+		return "", err
+	}
+
+	return from + `
+		JOIN regions r ON r.region_id = o.region_id
+		JOIN payment_methods pm ON pm.payment_method_id = o.payment_method_id
+		JOIN customers c ON c.customer_id = o.customer_id`, nil
+}
+
+// dimensionColumns resolves a dimension name to its columns, time is bucketed by the time grain
+func dimensionColumns(name, timeGrain string) ([]queryColumn, error) {
+	if name == "time" {
+		unit, timeFormat, err := timeBucket(timeGrain)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+		}
+		return []queryColumn{
+			{alias: "time_period", expr: "TO_CHAR(DATE_TRUNC('" + unit + "', o.sale_date), '" + timeFormat + "')"},
+		}, nil
+	}
+
+	dimension, ok := queryDimensions[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown dimension %q, must be one of %s", ErrInvalidQuery, name, strings.Join(queryDimensionNames(), ", "))
+	}
+	return dimension.columns, nil
+}
+
+// queryDimensionNames lists the supported dimensions for error messages
+func queryDimensionNames() []string {
+	names := []string{"time"}
+	for name := range queryDimensions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// queryMeasureNames lists the supported measures for error messages
+func queryMeasureNames() []string {
+	var names []string
+	for name := range queryMeasures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// compileQuery turns a generic query into SQL. Only known dimension, measure and sort names reach the SQL,
+// every filter value is passed as an argument.
+func compileQuery(q models.AnalyticsQuery) (string, []interface{}, error) {
+	if len(q.Measures) == 0 {
+		return "", nil, fmt.Errorf("%w: at least one measure is required", ErrInvalidQuery)
+	}
+
+	from, err := queryFrom(q.Filters.AsOf)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+	}
+
+	revenue, err := revenueMeasure(q.Filters.RevenueBasis)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+	}
+
+	var selects, groupBy []string
+	selected := make(map[string]bool)
+
+	for _, name := range q.Dimensions {
+		columns, err := dimensionColumns(name, q.TimeGrain)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, column := range columns {
+			if selected[column.alias] {
+				continue
+			}
+			selected[column.alias] = true
+			selects = append(selects, column.expr+" AS "+column.alias)
+			if !column.aggregate {
+				groupBy = append(groupBy, column.expr)
+			}
+		}
+	}
+
+	for _, name := range q.Measures {
+		measure, ok := queryMeasures[name]
+		if !ok {
+			return "", nil, fmt.Errorf("%w: unknown measure %q, must be one of %s", ErrInvalidQuery, name, strings.Join(queryMeasureNames(), ", "))
+		}
+		if selected[name] {
+			continue
+		}
+		selected[name] = true
+
+		selects = append(selects, strings.ReplaceAll(measure.expr, revenueToken, revenue)+" AS "+name)
+	}
+
+	var orderBy []string
+	for _, field := range q.Sort {
+		if !selected[field.Field] {
+			return "", nil, fmt.Errorf("%w: cannot sort by %q, it isn't a selected dimension or measure", ErrInvalidQuery, field.Field)
+		}
+
+		switch strings.ToLower(field.Direction) {
+		case "", "asc":
+			orderBy = append(orderBy, field.Field+" ASC")
+		case "desc":
+			orderBy = append(orderBy, field.Field+" DESC")
+		default:
+			return "", nil, fmt.Errorf("%w: sort direction must be 'asc' or 'desc'", ErrInvalidQuery)
+		}
+	}
+
+	// Default to the first measure, largest first
+	if len(orderBy) == 0 {
+		orderBy = append(orderBy, q.Measures[0]+" DESC")
+	}
+
+	limit := q.Limit
+	if limit <= 0 || limit > maxQueryRows {
+		limit = maxQueryRows
+	}
+
+	qa := &queryArgs{}
+	query := `
+		SELECT ` + strings.Join(selects, ", ") + `
+		` + from + `
+		` + whereClause(q.Filters, qa)
+
+	if len(groupBy) > 0 {
+		query += `
+		GROUP BY ` + strings.Join(groupBy, ", ")
+	}
+
+	query += `
+		ORDER BY ` + strings.Join(orderBy, ", ") + `
+		LIMIT ` + qa.add(limit)
+
+	return query, qa.values, nil
+}
+
+// RunQuery runs a generic dimension/measure query, returning one map per row keyed by column alias
+func (as *AnalyticsService) RunQuery(ctx context.Context, q models.AnalyticsQuery) ([]map[string]interface{}, error) {
+	query, args, err := compileQuery(q)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := as.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	results := []map[string]interface{}{}
+
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		for i, column := range columns {
+			measure, isMeasure := queryMeasures[column]
+			switch {
+			case isMeasure && measure.integer:
+				values[i] = new(int64)
+			case isMeasure:
+				values[i] = new(float64)
+			default:
+				values[i] = new(string)
+			}
+		}
+
+		if err := rows.Scan(values...); err != nil {
+			return nil, err
+		}
+
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			switch v := values[i].(type) {
+			case *int64:
+				row[column] = *v
+			case *float64:
+				row[column] = *v
+			case *string:
+				row[column] = *v
+			}
+		}
+		results = append(results, row)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
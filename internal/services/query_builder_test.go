@@ -0,0 +1,163 @@
+package services
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/prajwalbharadwajbm/backend_assessment/internal/models"
+)
+
+func testQuery() models.AnalyticsQuery {
+	return models.AnalyticsQuery{
+		Dimensions: []string{"region"},
+		Measures:   []string{"revenue"},
+		Filters:    models.Filter{StartDate: "2024-01-01", EndDate: "2024-12-31"},
+	}
+}
+
+func TestCompileQueryRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(q *models.AnalyticsQuery)
+	}{
+		{"no measures", func(q *models.AnalyticsQuery) { q.Measures = nil }},
+		{"unknown dimension", func(q *models.AnalyticsQuery) { q.Dimensions = []string{"warehouse"} }},
+		{"sql in dimension", func(q *models.AnalyticsQuery) { q.Dimensions = []string{"region; DROP TABLE orders"} }},
+		{"unknown measure", func(q *models.AnalyticsQuery) { q.Measures = []string{"profit"} }},
+		{"sql in measure", func(q *models.AnalyticsQuery) { q.Measures = []string{"SUM(1)"} }},
+		{"bad time grain", func(q *models.AnalyticsQuery) { q.Dimensions = []string{"time"}; q.TimeGrain = "hour" }},
+		{"sort by unselected field", func(q *models.AnalyticsQuery) { q.Sort = []models.SortField{{Field: "units"}} }},
+		{"sql in sort", func(q *models.AnalyticsQuery) { q.Sort = []models.SortField{{Field: "revenue; DROP TABLE orders"}} }},
+		{"bad sort direction", func(q *models.AnalyticsQuery) {
+			q.Sort = []models.SortField{{Field: "revenue", Direction: "sideways"}}
+		}},
+		{"bad as_of", func(q *models.AnalyticsQuery) { q.Filters.AsOf = "yesterday" }},
+		{"bad revenue basis", func(q *models.AnalyticsQuery) { q.Filters.RevenueBasis = "gross" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := testQuery()
+			tt.modify(&q)
+
+			if _, _, err := compileQuery(q); !errors.Is(err, ErrInvalidQuery) {
+				t.Errorf("compileQuery error = %v, want ErrInvalidQuery", err)
+			}
+		})
+	}
+}
+
+func TestCompileQueryFilterValuesAreArgs(t *testing.T) {
+	injection := "Books'; DROP TABLE orders; --"
+
+	q := testQuery()
+	q.Filters.Categories = []string{injection}
+	q.Filters.Regions = []string{injection}
+
+	query, args, err := compileQuery(q)
+	if err != nil {
+		t.Fatalf("compileQuery: %v", err)
+	}
+
+	if strings.Contains(query, "DROP TABLE") {
+		t.Errorf("filter value inlined into the SQL:\n%s", query)
+	}
+	var passed int
+	for _, arg := range args {
+		if valuer, ok := arg.(driver.Valuer); ok {
+			if v, _ := valuer.Value(); strings.Contains(fmt.Sprint(v), "DROP TABLE") {
+				passed++
+			}
+		}
+	}
+	if passed != 2 {
+		t.Errorf("args = %v, want the category and region values passed as arguments", args)
+	}
+	if !strings.Contains(query, "p.category = ANY($") {
+		t.Errorf("category filter missing from the SQL:\n%s", query)
+	}
+}
+
+func TestCompileQuery(t *testing.T) {
+	tests := []struct {
+		name      string
+		modify    func(q *models.AnalyticsQuery)
+		contains  []string
+		excludes  []string
+		wantLimit int
+	}{
+		{
+			name:      "defaults to the first measure descending",
+			modify:    func(q *models.AnalyticsQuery) { q.Measures = []string{"units", "revenue"} },
+			contains:  []string{"r.name AS region", " AS units", "GROUP BY r.name", "ORDER BY units DESC"},
+			wantLimit: maxQueryRows,
+		},
+		{
+			name: "product dimension returns id and name, grouped by id only",
+			modify: func(q *models.AnalyticsQuery) {
+				q.Dimensions = []string{"product", "product"}
+				q.Sort = []models.SortField{{Field: "product_name", Direction: "ASC"}}
+			},
+			contains:  []string{"p.product_id AS product_id, (ARRAY_AGG(p.name ORDER BY o.sale_date DESC))[1] AS product_name,", "GROUP BY p.product_id\n", "ORDER BY product_name ASC"},
+			excludes:  []string{"AS product_name, p.product_id", "GROUP BY p.product_id,"},
+			wantLimit: maxQueryRows,
+		},
+		{
+			name: "product names at the time of sale don't split a product",
+			modify: func(q *models.AnalyticsQuery) {
+				q.Dimensions = []string{"product"}
+				q.Filters.AsOf = AttributesAtSale
+			},
+			contains:  []string{"JOIN product_history p", "GROUP BY p.product_id\n"},
+			wantLimit: maxQueryRows,
+		},
+		{
+			name: "time dimension uses the grain",
+			modify: func(q *models.AnalyticsQuery) {
+				q.Dimensions = []string{"time"}
+				q.TimeGrain = "quarterly"
+				q.Limit = 5
+			},
+			contains:  []string{"DATE_TRUNC('quarter', o.sale_date)", "AS time_period"},
+			wantLimit: 5,
+		},
+		{
+			name: "no dimensions means no grouping",
+			modify: func(q *models.AnalyticsQuery) {
+				q.Dimensions = nil
+				q.Limit = maxQueryRows + 1
+			},
+			excludes:  []string{"GROUP BY"},
+			wantLimit: maxQueryRows,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := testQuery()
+			tt.modify(&q)
+
+			query, args, err := compileQuery(q)
+			if err != nil {
+				t.Fatalf("compileQuery: %v", err)
+			}
+
+			for _, s := range tt.contains {
+				if !strings.Contains(query, s) {
+					t.Errorf("SQL missing %q:\n%s", s, query)
+				}
+			}
+			for _, s := range tt.excludes {
+				if strings.Contains(query, s) {
+					t.Errorf("SQL has %q:\n%s", s, query)
+				}
+			}
+			if got := args[len(args)-1]; got != tt.wantLimit {
+				t.Errorf("limit = %v, want %d", got, tt.wantLimit)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Revenue sums are allowed to drift by a cent for every reconciliationRowsPerCent rows, and never by less than a cent.
+// Prices and discounts are rounded like the database rounds them, so only float summing error is left.
+const (
+	reconciliationTolerance   = 0.01
+	reconciliationRowsPerCent = 100
+)
+
+// Scale of the order_items columns, unit_price is DECIMAL(10, 2) and discount DECIMAL(5, 2)
+const (
+	unitPriceScale = 2
+	discountScale  = 2
+)
+
+// roundToScale rounds a value the way Postgres stores it in a DECIMAL column with the given scale:
+// half away from zero, on the decimal text the driver sends rather than the binary float,
+// so 1.005 becomes 1.01 as it does in the database.
+func roundToScale(value float64, scale int) float64 {
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(value, 'f', -1, 64))
+	if !ok {
+		return value
+	}
+
+	unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)
+	r.Mul(r, new(big.Rat).SetInt(unit))
+
+	q, rem := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	if new(big.Int).Mul(new(big.Int).Abs(rem), big.NewInt(2)).Cmp(r.Denom()) >= 0 {
+		q.Add(q, big.NewInt(int64(r.Sign())))
+	}
+
+	rounded, _ := new(big.Rat).SetFrac(q, unit).Float64()
+	return rounded
+}
+
+// controlTotals are the figures compared between the CSV file and the tables after a refresh
+type controlTotals struct {
+	RowCount       int     `json:"row_count"`
+	Quantity       int     `json:"quantity"`
+	GrossRevenue   float64 `json:"gross_revenue"`
+	NetRevenue     float64 `json:"net_revenue"`
+	DistinctOrders int     `json:"distinct_orders"`
+	// SkippedRows are file rows an append load left alone because they were already loaded
+	SkippedRows int `json:"skipped_rows,omitempty"`
+
+	orders map[string]struct{}
+	// itemLines is the file line each order and product was first seen on
+	itemLines map[string]int
+}
+
+func newControlTotals() *controlTotals {
+	return &controlTotals{orders: make(map[string]struct{}), itemLines: make(map[string]int)}
+}
+
+// seenItem records the line an order item is on and returns the earlier line if the file already had it
+func (ct *controlTotals) seenItem(orderID, productID string, line int) (int, bool) {
+	key := orderID + "\x00" + productID
+	if first, ok := ct.itemLines[key]; ok {
+		return first, true
+	}
+	ct.itemLines[key] = line
+	return 0, false
+}
+
+// add accumulates one CSV record into the totals, with the price and discount rounded to what is stored
+func (ct *controlTotals) add(orderID string, quantity int, unitPrice, discount float64) {
+	unitPrice = roundToScale(unitPrice, unitPriceScale)
+	discount = roundToScale(discount, discountScale)
+	gross := unitPrice * float64(quantity)
+
+	ct.RowCount++
+	ct.Quantity += quantity
+	ct.GrossRevenue += gross
+	ct.NetRevenue += gross * (1 - discount)
+
+	if _, seen := ct.orders[orderID]; !seen {
+		ct.orders[orderID] = struct{}{}
+		ct.DistinctOrders++
+	}
+}
+
+// skip counts a CSV record that wasn't written by this refresh, it isn't part of the compared totals
+func (ct *controlTotals) skip() {
+	ct.SkippedRows++
+}
+
+// tolerance is how far the revenue sums may drift apart, it grows with the number of rows
+func (ct *controlTotals) tolerance() float64 {
+	return reconciliationTolerance * math.Max(1, math.Ceil(float64(ct.RowCount)/reconciliationRowsPerCent))
+}
+
+// mismatches lists every figure that differs between the file and the database
+func (ct *controlTotals) mismatches(db *controlTotals) []string {
+	var diffs []string
+	tolerance := ct.tolerance()
+
+	if ct.RowCount != db.RowCount {
+		diffs = append(diffs, fmt.Sprintf("row_count file=%d db=%d", ct.RowCount, db.RowCount))
+	}
+	if ct.Quantity != db.Quantity {
+		diffs = append(diffs, fmt.Sprintf("quantity file=%d db=%d", ct.Quantity, db.Quantity))
+	}
+	if math.Abs(ct.GrossRevenue-db.GrossRevenue) > tolerance {
+		diffs = append(diffs, fmt.Sprintf("gross_revenue file=%.2f db=%.2f", ct.GrossRevenue, db.GrossRevenue))
+	}
+	if math.Abs(ct.NetRevenue-db.NetRevenue) > tolerance {
+		diffs = append(diffs, fmt.Sprintf("net_revenue file=%.2f db=%.2f", ct.NetRevenue, db.NetRevenue))
+	}
+	if ct.DistinctOrders != db.DistinctOrders {
+		diffs = append(diffs, fmt.Sprintf("distinct_orders file=%d db=%d", ct.DistinctOrders, db.DistinctOrders))
+	}
+
+	return diffs
+}
+
+// reconcile compares the control totals taken from the CSV file with the order items
+// stored by the same refresh, and records the outcome on the refresh log.
+// A mismatch is returned as an error so the refresh is reported as failed.
+func (dl *DataLoader) reconcile(ctx context.Context, logID int, fileTotals *controlTotals) error {
+	dbTotals := newControlTotals()
+	err := dl.db.QueryRowContext(ctx, `
+		SELECT
+			COUNT(*),
+			COALESCE(SUM(quantity), 0),
+			COALESCE(SUM(unit_price * quantity), 0),
+			COALESCE(SUM((unit_price * quantity) * (1 - discount)), 0),
+			COUNT(DISTINCT order_id)
+		FROM order_items
+		WHERE log_id = $1
+	`, logID).Scan(&dbTotals.RowCount, &dbTotals.Quantity, &dbTotals.GrossRevenue, &dbTotals.NetRevenue, &dbTotals.DistinctOrders)
+	if err != nil {
+		return fmt.Errorf("failed to compute database control totals: %w", err)
+	}
+
+	diffs := fileTotals.mismatches(dbTotals)
+
+	status := "MATCHED"
+	if len(diffs) > 0 {
+		status = "MISMATCHED"
+	}
+
+	report, err := json.Marshal(map[string]interface{}{
+		"file":       fileTotals,
+		"database":   dbTotals,
+		"mismatches": diffs,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal reconciliation report: %w", err)
+	}
+
+	_, err = dl.db.ExecContext(
+		ctx,
+		`UPDATE data_refresh_logs SET reconciliation_status = $1, reconciliation = $2 WHERE log_id = $3`,
+		status,
+		string(report),
+		logID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store reconciliation result: %w", err)
+	}
+
+	if len(diffs) > 0 {
+		dl.logger.Printf("RECONCILIATION MISMATCH for refresh %d: %s", logID, strings.Join(diffs, "; "))
+		return fmt.Errorf("reconciliation mismatch: %s", strings.Join(diffs, "; "))
+	}
+
+	dl.logger.Printf("Reconciliation for refresh %d matched (%d rows)", logID, fileTotals.RowCount)
+	return nil
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestControlTotalsAdd(t *testing.T) {
+	ct := newControlTotals()
+	ct.add("O1", 2, 10, 0)
+	ct.add("O1", 1, 5, 0.2)
+	ct.add("O2", 3, 1, 0)
+	ct.skip()
+
+	want := controlTotals{RowCount: 3, Quantity: 6, GrossRevenue: 28, NetRevenue: 27, DistinctOrders: 2, SkippedRows: 1}
+	got := *ct
+	got.orders, got.itemLines = nil, nil
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("totals = %+v, want %+v", got, want)
+	}
+}
+
+func TestRoundToScale(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want float64
+	}{
+		{19.99, 19.99},
+		{19.994, 19.99},
+		{19.995, 20.00},
+		{1.005, 1.01}, // 1.00499999... as a float, the database sees "1.005"
+		{0.125, 0.13},
+		{0.124999, 0.12},
+		{-2.675, -2.68},
+		{7, 7},
+	}
+
+	for _, tt := range tests {
+		if got := roundToScale(tt.in, 2); got != tt.want {
+			t.Errorf("roundToScale(%v, 2) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestControlTotalsAddSubCent(t *testing.T) {
+	ct := newControlTotals()
+	ct.add("O1", 3, 19.995, 0.125) // stored as 20.00 and 0.13
+	ct.add("O2", 1, 1.005, 0)      // stored as 1.01
+
+	// What the database sums from the stored columns
+	db := &controlTotals{RowCount: 2, Quantity: 4, GrossRevenue: 61.01, NetRevenue: 53.21, DistinctOrders: 2}
+	if diffs := ct.mismatches(db); diffs != nil {
+		t.Errorf("mismatches = %q, want none", diffs)
+	}
+}
+
+func TestControlTotalsTolerance(t *testing.T) {
+	tests := []struct {
+		rows int
+		want float64
+	}{
+		{0, 0.01},
+		{1, 0.01},
+		{100, 0.01},
+		{101, 0.02},
+		{25000, 2.5},
+	}
+
+	for _, tt := range tests {
+		ct := controlTotals{RowCount: tt.rows}
+		if got := ct.tolerance(); !almostEqual(got, tt.want) {
+			t.Errorf("tolerance for %d rows = %v, want %v", tt.rows, got, tt.want)
+		}
+	}
+}
+
+func TestControlTotalsMismatches(t *testing.T) {
+	file := controlTotals{RowCount: 10, Quantity: 25, GrossRevenue: 500, NetRevenue: 450, DistinctOrders: 4}
+
+	tests := []struct {
+		name string
+		db   controlTotals
+		want []string
+	}{
+		{
+			name: "matching",
+			db:   file,
+		},
+		{
+			name: "rounding within tolerance",
+			db:   controlTotals{RowCount: 10, Quantity: 25, GrossRevenue: 500.004, NetRevenue: 449.996, DistinctOrders: 4},
+		},
+		{
+			name: "skipped rows aren't compared",
+			db:   controlTotals{RowCount: 10, Quantity: 25, GrossRevenue: 500, NetRevenue: 450, DistinctOrders: 4, SkippedRows: 3},
+		},
+		{
+			name: "missing row",
+			db:   controlTotals{RowCount: 9, Quantity: 23, GrossRevenue: 480, NetRevenue: 450, DistinctOrders: 4},
+			want: []string{
+				"row_count file=10 db=9",
+				"quantity file=25 db=23",
+				"gross_revenue file=500.00 db=480.00",
+			},
+		},
+		{
+			name: "every figure off",
+			db:   controlTotals{RowCount: 11, Quantity: 26, GrossRevenue: 510, NetRevenue: 460.5, DistinctOrders: 5},
+			want: []string{
+				"row_count file=10 db=11",
+				"quantity file=25 db=26",
+				"gross_revenue file=500.00 db=510.00",
+				"net_revenue file=450.00 db=460.50",
+				"distinct_orders file=4 db=5",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := file.mismatches(&tt.db)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mismatches = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -14,6 +14,7 @@ type RefreshScheduler struct {
 	cron       *cron.Cron
 	logger     *log.Logger
 	csvPath    string
+	loadMode   string
 }
 
 func NewRefreshScheduler(dataLoader *DataLoader, cfg *config.Config, logger *log.Logger) *RefreshScheduler {
@@ -22,6 +23,7 @@ func NewRefreshScheduler(dataLoader *DataLoader, cfg *config.Config, logger *log
 		cron:       cron.New(),
 		logger:     logger,
 		csvPath:    cfg.DefaultCSVPath, // Default CSV path fetched from env variable(can be overridden via API in payload)
+		loadMode:   cfg.RefreshLoadMode,
 	}
 }
 
@@ -38,7 +40,7 @@ func (rs *RefreshScheduler) Start(ctx context.Context, schedule string) error {
 		refreshCtx, cancel := context.WithTimeout(ctx, 1*time.Hour)
 		defer cancel()
 
-		if err := rs.dataLoader.RefreshData(refreshCtx, rs.csvPath, "SCHEDULER"); err != nil {
+		if err := rs.dataLoader.RefreshData(refreshCtx, rs.csvPath, "SCHEDULER", rs.loadMode); err != nil {
 			rs.logger.Printf("Scheduled data refresh failed: %v", err)
 		} else {
 			rs.logger.Println("Scheduled data refresh completed successfully")
@@ -0,0 +1,272 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// RFM segments, from the best customers to the ones that are gone
+const (
+	SegmentChampions          = "champions"
+	SegmentLoyal              = "loyal"
+	SegmentPotentialLoyalists = "potential_loyalists"
+	SegmentNewCustomers       = "new_customers"
+	SegmentNeedAttention      = "need_attention"
+	SegmentCantLoseThem       = "cant_lose_them"
+	SegmentAtRisk             = "at_risk"
+	SegmentHibernating        = "hibernating"
+	SegmentLost               = "lost"
+)
+
+// RFMSegments lists every segment a customer can be placed in
+var RFMSegments = []string{
+	SegmentChampions,
+	SegmentLoyal,
+	SegmentPotentialLoyalists,
+	SegmentNewCustomers,
+	SegmentNeedAttention,
+	SegmentCantLoseThem,
+	SegmentAtRisk,
+	SegmentHibernating,
+	SegmentLost,
+}
+
+// rfmSegment names the segment for a set of scores between 1 and buckets.
+// Scores are scaled to 0-1 so the rules hold for any number of buckets,
+// frequency and monetary are averaged since they tend to move together.
+func rfmSegment(r, f, m, buckets int) string {
+	recency := float64(r) / float64(buckets)
+	frequency := float64(f) / float64(buckets)
+	value := float64(f+m) / float64(2*buckets)
+
+	switch {
+	case recency >= 0.8 && value >= 0.8:
+		return SegmentChampions
+	case recency >= 0.6 && value >= 0.6:
+		return SegmentLoyal
+	case recency >= 0.8 && frequency <= 0.4:
+		return SegmentNewCustomers
+	case recency >= 0.6 && value >= 0.4:
+		return SegmentPotentialLoyalists
+	case recency <= 0.2 && value >= 0.8:
+		return SegmentCantLoseThem
+	case recency <= 0.4 && value >= 0.6:
+		return SegmentAtRisk
+	case recency <= 0.2 && value <= 0.4:
+		return SegmentLost
+	case recency <= 0.4:
+		return SegmentHibernating
+	default:
+		return SegmentNeedAttention
+	}
+}
+
+// rfmBucket scores customers from 1 to buckets ($1) by their percent rank in the ordering.
+// Tied customers share a rank and so always get the same score, unlike NTILE which splits ties
+// across buckets arbitrarily. Ties sit at the bottom of their range, so the many one time buyers
+// all get the lowest frequency score.
+func rfmBucket(orderBy string) string {
+	return "LEAST(FLOOR(PERCENT_RANK() OVER (ORDER BY " + orderBy + ") * $1) + 1, $1)::int"
+}
+
+// RefreshRFMScores recomputes recency, frequency and monetary scores for every customer into percentile buckets
+// and replaces customer_rfm_scores. Recency is measured from the latest sale in the data rather than today,
+// so loading an old file still gives meaningful scores. Linked customer IDs are scored as their master customer.
+func (as *AnalyticsService) RefreshRFMScores(ctx context.Context, logID int, buckets int) error {
+	if buckets < 2 {
+		return fmt.Errorf("rfm buckets must be at least 2, got %d", buckets)
+	}
+
+	rows, err := as.db.QueryContext(ctx, `
+		WITH customer_totals AS (
+			SELECT
+				COALESCE(c.master_customer_id, c.customer_id) as customer_id,
+				(SELECT MAX(sale_date) FROM orders) - MAX(o.sale_date) as recency_days,
+				COUNT(DISTINCT o.order_id) as frequency,
+				COALESCE(SUM(`+revenueExpr+`), 0) as monetary
+			FROM order_items oi
+			JOIN orders o ON oi.order_id = o.order_id
+			JOIN customers c ON o.customer_id = c.customer_id
+			GROUP BY COALESCE(c.master_customer_id, c.customer_id)
+		)
+		SELECT
+			customer_id,
+			recency_days,
+			frequency,
+			monetary,
+			`+rfmBucket("recency_days DESC")+` as r_score,
+			`+rfmBucket("frequency")+` as f_score,
+			`+rfmBucket("monetary")+` as m_score
+		FROM customer_totals
+	`, buckets)
+	if err != nil {
+		return fmt.Errorf("failed to compute rfm scores: %w", err)
+	}
+	defer rows.Close()
+
+	type rfmScore struct {
+		customerID             string
+		recencyDays, frequency int
+		monetary               float64
+		rScore, fScore, mScore int
+	}
+
+	var scores []rfmScore
+	for rows.Next() {
+		var score rfmScore
+		if err := rows.Scan(&score.customerID, &score.recencyDays, &score.frequency, &score.monetary, &score.rScore, &score.fScore, &score.mScore); err != nil {
+			return err
+		}
+		scores = append(scores, score)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	tx, err := as.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM customer_rfm_scores`); err != nil {
+		return fmt.Errorf("failed to clear rfm scores: %w", err)
+	}
+
+	insertStmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO customer_rfm_scores
+			(customer_id, recency_days, frequency, monetary, r_score, f_score, m_score, buckets, segment, log_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare rfm score statement: %w", err)
+	}
+	defer insertStmt.Close()
+
+	for _, score := range scores {
+		_, err := insertStmt.ExecContext(
+			ctx,
+			score.customerID,
+			score.recencyDays,
+			score.frequency,
+			score.monetary,
+			score.rScore,
+			score.fScore,
+			score.mScore,
+			buckets,
+			rfmSegment(score.rScore, score.fScore, score.mScore, buckets),
+			logID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert rfm score: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetRFMScores returns the stored RFM scores, optionally only for the given segments
+// along with the number of customers and revenue in each segment
+func (as *AnalyticsService) GetRFMScores(ctx context.Context, segments []string, limit int) ([]map[string]interface{}, []map[string]interface{}, error) {
+	qa := &queryArgs{}
+	where := ""
+	if len(segments) > 0 {
+		where = "WHERE s.segment = ANY(" + qa.add(pq.Array(segments)) + ")"
+	}
+
+	limitSQL := ""
+	if limit > 0 {
+		limitSQL = "LIMIT " + qa.add(limit)
+	}
+
+	rows, err := as.db.QueryContext(ctx, `
+		SELECT
+			s.customer_id,
+			c.name,
+			s.recency_days,
+			s.frequency,
+			s.monetary,
+			s.r_score,
+			s.f_score,
+			s.m_score,
+			s.segment,
+			s.computed_at
+		FROM customer_rfm_scores s
+		JOIN customers c ON c.customer_id = s.customer_id
+		`+where+`
+		ORDER BY s.r_score + s.f_score + s.m_score DESC, s.monetary DESC
+		`+limitSQL, qa.values...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var customers []map[string]interface{}
+
+	for rows.Next() {
+		var customerID, name, segment string
+		var recencyDays, frequency, rScore, fScore, mScore int
+		var monetary float64
+		var computedAt time.Time
+
+		if err := rows.Scan(&customerID, &name, &recencyDays, &frequency, &monetary, &rScore, &fScore, &mScore, &segment, &computedAt); err != nil {
+			return nil, nil, err
+		}
+
+		customers = append(customers, map[string]interface{}{
+			"customer_id":  customerID,
+			"name":         name,
+			"recency_days": recencyDays,
+			"frequency":    frequency,
+			"monetary":     monetary,
+			"r_score":      rScore,
+			"f_score":      fScore,
+			"m_score":      mScore,
+			"rfm_score":    fmt.Sprintf("%d%d%d", rScore, fScore, mScore),
+			"segment":      segment,
+			"computed_at":  computedAt,
+		})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	summaryRows, err := as.db.QueryContext(ctx, `
+		SELECT segment, COUNT(*), COALESCE(SUM(monetary), 0)
+		FROM customer_rfm_scores
+		GROUP BY segment
+		ORDER BY SUM(monetary) DESC
+	`)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer summaryRows.Close()
+
+	var summary []map[string]interface{}
+
+	for summaryRows.Next() {
+		var segment string
+		var customerCount int
+		var revenue float64
+
+		if err := summaryRows.Scan(&segment, &customerCount, &revenue); err != nil {
+			return nil, nil, err
+		}
+
+		summary = append(summary, map[string]interface{}{
+			"segment":   segment,
+			"customers": customerCount,
+			"revenue":   revenue,
+		})
+	}
+
+	if err = summaryRows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return customers, summary, nil
+}
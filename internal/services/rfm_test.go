@@ -0,0 +1,51 @@
+package services
+
+import "testing"
+
+func TestRFMSegment(t *testing.T) {
+	tests := []struct {
+		r, f, m, buckets int
+		want             string
+	}{
+		{5, 5, 5, 5, SegmentChampions},
+		{4, 4, 3, 5, SegmentLoyal},
+		{4, 3, 2, 5, SegmentPotentialLoyalists},
+		{5, 1, 1, 5, SegmentNewCustomers},
+		{3, 1, 1, 5, SegmentNeedAttention},
+		{1, 5, 5, 5, SegmentCantLoseThem},
+		{2, 4, 3, 5, SegmentAtRisk},
+		{2, 2, 2, 5, SegmentHibernating},
+		{1, 1, 2, 5, SegmentLost},
+
+		// The rules scale with the number of buckets
+		{9, 9, 8, 10, SegmentChampions},
+		{2, 9, 10, 10, SegmentCantLoseThem},
+		{4, 4, 4, 4, SegmentChampions},
+		{1, 1, 1, 4, SegmentHibernating},
+	}
+
+	for _, tt := range tests {
+		if got := rfmSegment(tt.r, tt.f, tt.m, tt.buckets); got != tt.want {
+			t.Errorf("rfmSegment(%d, %d, %d, %d) = %q, want %q", tt.r, tt.f, tt.m, tt.buckets, got, tt.want)
+		}
+	}
+}
+
+func TestRFMSegmentsCoverAllScores(t *testing.T) {
+	known := make(map[string]bool)
+	for _, segment := range RFMSegments {
+		known[segment] = true
+	}
+
+	for buckets := 2; buckets <= 10; buckets++ {
+		for r := 1; r <= buckets; r++ {
+			for f := 1; f <= buckets; f++ {
+				for m := 1; m <= buckets; m++ {
+					if segment := rfmSegment(r, f, m, buckets); !known[segment] {
+						t.Fatalf("rfmSegment(%d, %d, %d, %d) = %q, which isn't in RFMSegments", r, f, m, buckets, segment)
+					}
+				}
+			}
+		}
+	}
+}
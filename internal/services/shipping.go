@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/prajwalbharadwajbm/backend_assessment/internal/models"
+)
+
+// Groupings for shipping cost reporting
+var shippingGroups = map[string]string{
+	"region":         "r.name",
+	"payment_method": "pm.name",
+}
+
+// GetShippingCosts returns shipping cost totals by region or payment method along with product revenue,
+// shipping as a percentage of that revenue and the average shipping cost per order.
+// Shipping is spread over each order's items, so item level filters such as category only count their share.
+// The summary holds the same figures over every group, including the ones cut off by the limit.
+func (as *AnalyticsService) GetShippingCosts(ctx context.Context, f models.Filter, groupBy string) ([]map[string]interface{}, map[string]interface{}, error) {
+	group, ok := shippingGroups[groupBy]
+	if !ok {
+		return nil, nil, errors.New("invalid group_by: must be 'region' or 'payment_method'")
+	}
+
+	from, err := revenueFrom(f.AsOf)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	qa := &queryArgs{}
+	query := `
+		SELECT
+			` + group + `,
+			COUNT(DISTINCT o.order_id) as orders,
+			COALESCE(SUM(` + shippingShareExpr + `), 0) as shipping_cost,
+			COALESCE(SUM(` + revenueExpr + `), 0) as revenue,
+			SUM(COUNT(DISTINCT o.order_id)) OVER () as total_orders,
+			SUM(COALESCE(SUM(` + shippingShareExpr + `), 0)) OVER () as total_shipping_cost,
+			SUM(COALESCE(SUM(` + revenueExpr + `), 0)) OVER () as total_revenue
+		` + from + `
+		JOIN regions r ON r.region_id = o.region_id
+		JOIN payment_methods pm ON pm.payment_method_id = o.payment_method_id
+		` + whereClause(f, qa) + `
+		GROUP BY ` + group + `
+		ORDER BY shipping_cost DESC
+		` + limitClause(f, qa) + `
+	`
+
+	rows, err := as.db.QueryContext(ctx, query, qa.values...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var results []map[string]interface{}
+	var totalOrders int
+	var totalShipping, totalRevenue float64
+
+	for rows.Next() {
+		var name string
+		var orders int
+		var shippingCost, revenue float64
+
+		if err := rows.Scan(&name, &orders, &shippingCost, &revenue, &totalOrders, &totalShipping, &totalRevenue); err != nil {
+			return nil, nil, err
+		}
+
+		row := shippingFigures(orders, shippingCost, revenue)
+		row[groupBy] = name
+		results = append(results, row)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return results, shippingFigures(totalOrders, totalShipping, totalRevenue), nil
+}
+
+// shippingFigures derives the shipping percentage and average per order, both nil when undefined
+func shippingFigures(orders int, shippingCost, revenue float64) map[string]interface{} {
+	var shippingPct, avgPerOrder *float64
+	if revenue != 0 {
+		pct := shippingCost / revenue * 100
+		shippingPct = &pct
+	}
+	if orders != 0 {
+		avg := shippingCost / float64(orders)
+		avgPerOrder = &avg
+	}
+
+	return map[string]interface{}{
+		"orders":                 orders,
+		"shipping_cost":          shippingCost,
+		"revenue":                revenue,
+		"shipping_pct":           shippingPct,
+		"avg_shipping_per_order": avgPerOrder,
+	}
+}
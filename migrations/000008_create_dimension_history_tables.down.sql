@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS customer_observations;
+DROP TABLE IF EXISTS product_observations;
+DROP TABLE IF EXISTS customer_history;
+DROP TABLE IF EXISTS product_history;
@@ -0,0 +1,78 @@
+-- Type-2 history for products and customers.
+-- valid_to is NULL for the current version of a row.
+CREATE TABLE IF NOT EXISTS product_history (
+    product_history_id SERIAL PRIMARY KEY,
+    product_id VARCHAR(50) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    category VARCHAR(100) NOT NULL,
+    valid_from DATE NOT NULL,
+    valid_to DATE,
+    FOREIGN KEY (product_id) REFERENCES products(product_id)
+);
+
+CREATE INDEX idx_product_history_product_id ON product_history(product_id, valid_from);
+CREATE UNIQUE INDEX uk_product_history_current ON product_history(product_id) WHERE valid_to IS NULL;
+
+CREATE TABLE IF NOT EXISTS customer_history (
+    customer_history_id SERIAL PRIMARY KEY,
+    customer_id VARCHAR(50) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    email VARCHAR(100) NOT NULL,
+    address TEXT,
+    valid_from DATE NOT NULL,
+    valid_to DATE,
+    FOREIGN KEY (customer_id) REFERENCES customers(customer_id)
+);
+
+CREATE INDEX idx_customer_history_customer_id ON customer_history(customer_id, valid_from);
+CREATE UNIQUE INDEX uk_customer_history_current ON customer_history(customer_id) WHERE valid_to IS NULL;
+
+-- The attributes seen on each sale date, one row per day (the last loaded row of a day wins).
+-- History is rebuilt from these, so it doesn't depend on the order rows and files are loaded in.
+CREATE TABLE IF NOT EXISTS product_observations (
+    product_id VARCHAR(50) NOT NULL,
+    sale_date DATE NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    category VARCHAR(100) NOT NULL,
+    log_id INT,
+    PRIMARY KEY (product_id, sale_date),
+    FOREIGN KEY (product_id) REFERENCES products(product_id),
+    FOREIGN KEY (log_id) REFERENCES data_refresh_logs(log_id)
+);
+
+CREATE INDEX idx_product_observations_log_id ON product_observations(log_id);
+
+CREATE TABLE IF NOT EXISTS customer_observations (
+    customer_id VARCHAR(50) NOT NULL,
+    sale_date DATE NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    email VARCHAR(100) NOT NULL,
+    address TEXT,
+    log_id INT,
+    PRIMARY KEY (customer_id, sale_date),
+    FOREIGN KEY (customer_id) REFERENCES customers(customer_id),
+    FOREIGN KEY (log_id) REFERENCES data_refresh_logs(log_id)
+);
+
+CREATE INDEX idx_customer_observations_log_id ON customer_observations(log_id);
+
+-- Seed the first version from what is already loaded, valid for every past sale.
+-- The loaded attributes are those of the latest sale, so that's the date they are observed on.
+INSERT INTO product_history (product_id, name, category, valid_from)
+SELECT product_id, name, category, '-infinity'::date FROM products;
+
+INSERT INTO customer_history (customer_id, name, email, address, valid_from)
+SELECT customer_id, name, email, address, '-infinity'::date FROM customers;
+
+INSERT INTO product_observations (product_id, sale_date, name, category)
+SELECT p.product_id, COALESCE(MAX(o.sale_date), '-infinity'::date), p.name, p.category
+FROM products p
+LEFT JOIN order_items oi ON oi.product_id = p.product_id
+LEFT JOIN orders o ON o.order_id = oi.order_id
+GROUP BY p.product_id, p.name, p.category;
+
+INSERT INTO customer_observations (customer_id, sale_date, name, email, address)
+SELECT c.customer_id, COALESCE(MAX(o.sale_date), '-infinity'::date), c.name, c.email, c.address
+FROM customers c
+LEFT JOIN orders o ON o.customer_id = c.customer_id
+GROUP BY c.customer_id, c.name, c.email, c.address;
@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS customer_identity_conflicts;
+
+DROP INDEX IF EXISTS idx_customers_master_customer_id;
+DROP INDEX IF EXISTS idx_customers_name_address_key;
+DROP INDEX IF EXISTS idx_customers_email;
+
+ALTER TABLE customers DROP COLUMN IF EXISTS name_address_key;
+ALTER TABLE customers DROP COLUMN IF EXISTS master_customer_id;
+
+ALTER TABLE customers ADD CONSTRAINT uk_customer_email UNIQUE (email);
@@ -0,0 +1,41 @@
+-- Customer IDs that share an email (account merges) no longer abort the refresh,
+-- they are linked to a master customer instead
+ALTER TABLE customers DROP CONSTRAINT IF EXISTS uk_customer_email;
+
+ALTER TABLE customers ADD COLUMN master_customer_id VARCHAR(50) REFERENCES customers(customer_id);
+ALTER TABLE customers ADD COLUMN name_address_key TEXT;
+
+CREATE INDEX idx_customers_email ON customers(LOWER(TRIM(email)));
+CREATE INDEX idx_customers_name_address_key ON customers(name_address_key);
+CREATE INDEX idx_customers_master_customer_id ON customers(master_customer_id);
+
+CREATE TABLE IF NOT EXISTS customer_identity_conflicts (
+    conflict_id SERIAL PRIMARY KEY,
+    customer_id VARCHAR(50) NOT NULL,
+    matched_customer_id VARCHAR(50) NOT NULL,
+    master_customer_id VARCHAR(50) NOT NULL,
+    match_reason VARCHAR(20) NOT NULL, -- 'EMAIL', 'NAME_ADDRESS'
+    log_id INT,
+    detected_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (customer_id) REFERENCES customers(customer_id),
+    FOREIGN KEY (matched_customer_id) REFERENCES customers(customer_id),
+    FOREIGN KEY (master_customer_id) REFERENCES customers(customer_id),
+    FOREIGN KEY (log_id) REFERENCES data_refresh_logs(log_id)
+);
+
+CREATE INDEX idx_customer_identity_conflicts_customer_id ON customer_identity_conflicts(customer_id);
+
+-- Backfill the match key for customers loaded before this migration, normalized like nameAddressKey:
+-- lower case, punctuation replaced by spaces, whitespace collapsed, blank when name or address is empty
+UPDATE customers c
+SET name_address_key = k.name || '|' || k.address
+FROM (
+    SELECT
+        customer_id,
+        BTRIM(REGEXP_REPLACE(REGEXP_REPLACE(LOWER(name), '[^[:alnum:][:space:]]', ' ', 'g'), '[[:space:]]+', ' ', 'g')) as name,
+        BTRIM(REGEXP_REPLACE(REGEXP_REPLACE(LOWER(COALESCE(address, '')), '[^[:alnum:][:space:]]', ' ', 'g'), '[[:space:]]+', ' ', 'g')) as address
+    FROM customers
+) k
+WHERE k.customer_id = c.customer_id
+  AND k.name <> ''
+  AND k.address <> '';
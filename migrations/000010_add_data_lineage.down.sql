@@ -0,0 +1,14 @@
+DROP INDEX IF EXISTS idx_order_items_log_id;
+DROP INDEX IF EXISTS idx_orders_log_id;
+
+ALTER TABLE order_items DROP COLUMN IF EXISTS log_id;
+ALTER TABLE order_items DROP COLUMN IF EXISTS source_line;
+ALTER TABLE order_items DROP COLUMN IF EXISTS source_id;
+
+ALTER TABLE orders DROP COLUMN IF EXISTS log_id;
+ALTER TABLE orders DROP COLUMN IF EXISTS source_line;
+ALTER TABLE orders DROP COLUMN IF EXISTS source_id;
+
+ALTER TABLE data_refresh_logs DROP COLUMN IF EXISTS source_id;
+
+DROP TABLE IF EXISTS data_sources;
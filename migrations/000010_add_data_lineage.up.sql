@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS data_sources (
+    source_id SERIAL PRIMARY KEY,
+    file_name TEXT NOT NULL,
+    file_checksum CHAR(64) NOT NULL, -- sha256 of the file contents
+    first_loaded_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CONSTRAINT uk_data_source_file UNIQUE (file_name, file_checksum)
+);
+
+ALTER TABLE data_refresh_logs ADD COLUMN source_id INT REFERENCES data_sources(source_id);
+
+ALTER TABLE orders ADD COLUMN source_id INT REFERENCES data_sources(source_id);
+ALTER TABLE orders ADD COLUMN source_line INT;
+ALTER TABLE orders ADD COLUMN log_id INT REFERENCES data_refresh_logs(log_id);
+
+ALTER TABLE order_items ADD COLUMN source_id INT REFERENCES data_sources(source_id);
+ALTER TABLE order_items ADD COLUMN source_line INT;
+ALTER TABLE order_items ADD COLUMN log_id INT REFERENCES data_refresh_logs(log_id);
+
+CREATE INDEX idx_orders_log_id ON orders(log_id);
+CREATE INDEX idx_order_items_log_id ON order_items(log_id);
@@ -0,0 +1,2 @@
+ALTER TABLE data_refresh_logs DROP COLUMN IF EXISTS reconciliation;
+ALTER TABLE data_refresh_logs DROP COLUMN IF EXISTS reconciliation_status;
@@ -0,0 +1,2 @@
+ALTER TABLE data_refresh_logs ADD COLUMN reconciliation_status VARCHAR(20); -- 'MATCHED', 'MISMATCHED'
+ALTER TABLE data_refresh_logs ADD COLUMN reconciliation JSONB;
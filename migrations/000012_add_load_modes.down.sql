@@ -0,0 +1,3 @@
+ALTER TABLE data_refresh_logs DROP COLUMN IF EXISTS load_mode;
+
+DROP INDEX IF EXISTS uk_order_items_order_product;
@@ -0,0 +1,11 @@
+-- Upserting order items needs a natural key: a product appears on at most one line per order.
+-- The loader rejects files that repeat a product in an order, existing duplicates keep the most recently loaded one
+DELETE FROM order_items a
+USING order_items b
+WHERE a.order_id = b.order_id
+  AND a.product_id = b.product_id
+  AND a.order_item_id < b.order_item_id;
+
+CREATE UNIQUE INDEX uk_order_items_order_product ON order_items(order_id, product_id);
+
+ALTER TABLE data_refresh_logs ADD COLUMN load_mode VARCHAR(20) NOT NULL DEFAULT 'upsert'; -- 'append', 'upsert', 'full_replace', 'partition_replace'
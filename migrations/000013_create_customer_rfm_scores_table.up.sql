@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS customer_rfm_scores (
+    customer_id VARCHAR(50) PRIMARY KEY, -- master customer, linked customer IDs are scored together
+    recency_days INT NOT NULL,
+    frequency INT NOT NULL,
+    monetary DECIMAL(12, 2) NOT NULL,
+    r_score INT NOT NULL,
+    f_score INT NOT NULL,
+    m_score INT NOT NULL,
+    buckets INT NOT NULL,
+    segment VARCHAR(30) NOT NULL,
+    log_id INT,
+    computed_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (customer_id) REFERENCES customers(customer_id),
+    FOREIGN KEY (log_id) REFERENCES data_refresh_logs(log_id)
+);
+
+CREATE INDEX idx_customer_rfm_scores_segment ON customer_rfm_scores(segment);
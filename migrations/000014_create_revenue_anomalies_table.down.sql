@@ -0,0 +1,3 @@
+ALTER TABLE data_refresh_logs DROP COLUMN IF EXISTS anomalies;
+ALTER TABLE data_refresh_logs DROP COLUMN IF EXISTS anomaly_count;
+DROP TABLE IF EXISTS revenue_anomalies;
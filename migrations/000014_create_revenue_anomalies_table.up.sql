@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS revenue_anomalies (
+    anomaly_id SERIAL PRIMARY KEY,
+    dimension VARCHAR(20) NOT NULL, -- 'region', 'category'
+    dimension_value VARCHAR(100) NOT NULL,
+    sale_date DATE NOT NULL,
+    revenue DECIMAL(12, 2) NOT NULL,
+    expected DECIMAL(12, 2) NOT NULL, -- average of the same weekday over the previous weeks
+    z_score DOUBLE PRECISION NOT NULL,
+    direction VARCHAR(10) NOT NULL, -- 'drop', 'spike'
+    log_id INT,
+    detected_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (log_id) REFERENCES data_refresh_logs(log_id)
+);
+
+CREATE INDEX idx_revenue_anomalies_sale_date ON revenue_anomalies(sale_date);
+
+ALTER TABLE data_refresh_logs ADD COLUMN anomaly_count INT;
+ALTER TABLE data_refresh_logs ADD COLUMN anomalies JSONB; -- anomalies on the sale dates loaded by the refresh
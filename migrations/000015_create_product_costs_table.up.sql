@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS product_costs (
+    product_cost_id SERIAL PRIMARY KEY,
+    product_id VARCHAR(50) NOT NULL,
+    unit_cost DECIMAL(10, 2) NOT NULL,
+    effective_from DATE NOT NULL, -- in effect until the next cost of the same product
+    loaded_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (product_id) REFERENCES products(product_id),
+    CONSTRAINT uk_product_costs_product_effective UNIQUE (product_id, effective_from)
+);
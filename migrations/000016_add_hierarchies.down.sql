@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS product_subcategories;
+DROP TABLE IF EXISTS location_hierarchy;
+ALTER TABLE customers DROP COLUMN IF EXISTS city;
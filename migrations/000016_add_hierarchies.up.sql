@@ -0,0 +1,22 @@
+-- City is derived from the customer address ("street, city, state zip") when customers are loaded
+ALTER TABLE customers ADD COLUMN city VARCHAR(100);
+
+UPDATE customers
+SET city = NULLIF(TRIM((STRING_TO_ARRAY(address, ','))[ARRAY_LENGTH(STRING_TO_ARRAY(address, ','), 1) - 1]), '')
+WHERE ARRAY_LENGTH(STRING_TO_ARRAY(address, ','), 1) >= 3;
+
+-- Region -> country -> city, loaded from a mapping file
+CREATE TABLE IF NOT EXISTS location_hierarchy (
+    location_id SERIAL PRIMARY KEY,
+    region VARCHAR(50) NOT NULL,
+    country VARCHAR(100) NOT NULL,
+    city VARCHAR(100) NOT NULL,
+    CONSTRAINT uk_location_hierarchy_region_city UNIQUE (region, city)
+);
+
+-- Category -> subcategory, loaded from a mapping file
+CREATE TABLE IF NOT EXISTS product_subcategories (
+    product_id VARCHAR(50) PRIMARY KEY,
+    subcategory VARCHAR(100) NOT NULL,
+    FOREIGN KEY (product_id) REFERENCES products(product_id)
+);
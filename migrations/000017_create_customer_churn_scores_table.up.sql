@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS customer_churn_scores (
+    customer_id VARCHAR(50) PRIMARY KEY, -- master customer, linked customer IDs are scored together
+    orders INT NOT NULL,
+    revenue DECIMAL(12, 2) NOT NULL,
+    last_purchase DATE NOT NULL,
+    recency_days INT NOT NULL,
+    avg_interval_days DECIMAL(10, 2) NOT NULL, -- the customer's own, or the typical interval for one time buyers
+    churn_probability DECIMAL(5, 4) NOT NULL,
+    risk VARCHAR(10) NOT NULL, -- 'low', 'medium', 'high'
+    expected_next_purchase DATE NOT NULL,
+    log_id INT,
+    computed_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (customer_id) REFERENCES customers(customer_id),
+    FOREIGN KEY (log_id) REFERENCES data_refresh_logs(log_id)
+);
+
+CREATE INDEX idx_customer_churn_scores_risk ON customer_churn_scores(risk);